@@ -7,11 +7,13 @@ package main
 // HELPER TYPES //
 // ============ //
 
-// A register in assembly. This is a value between `-1` and `15` inclusive. `-1` represents no
-// register.
+// A register in assembly. This is a value between `-2` and `15` inclusive. `-1` represents no
+// register, and `-2` represents a register in a function head that is chosen by each caller of
+// the function.
 type Register int8
 
 const UnknownRegister Register = -1
+const AnyRegister Register = -2
 
 // A register, a name, and a location. This is used to represent function arguments,
 // and function mutated registers.
@@ -19,6 +21,9 @@ type registerAndNameAndLocation struct {
 	textLocation
 	register Register
 	name     string
+	// The struct that the variable points to or the enum that the variable stores, or a blank string
+	// if it is not given
+	typeName string
 }
 
 // Compares 2 raw values (currently this does not include boolean values)
@@ -34,6 +39,37 @@ const (
 	NotEqual
 )
 
+// The number of bits that a pointer dereference reads or writes, and whether a value that is read
+// from memory is sign extended rather then zero extended to fill a 64 bit register
+type memoryAccessSize struct {
+	bits     uint8
+	isSigned bool
+}
+
+// The sizes that can be written after `^`. `^` on its own uses 64 bits.
+var memoryAccessSizes = map[string]memoryAccessSize{
+	"u8":  {bits: 8},
+	"i8":  {bits: 8, isSigned: true},
+	"u16": {bits: 16},
+	"i16": {bits: 16, isSigned: true},
+	"u32": {bits: 32},
+	"i32": {bits: 32, isSigned: true},
+	"u64": {bits: 64},
+	"i64": {bits: 64, isSigned: true},
+}
+
+// The part of a memory address that is added to a pointer, for example `index * 8 + 16` in
+// `^(pointer + index * 8 + 16)`. This is the same as the index, scale, and displacement of an x86
+// memory operand.
+type memoryOffset struct {
+	// The variable that is multiplied by `scale`, or a blank string if there is no index
+	index         string
+	indexLocation textLocation
+	// Either 1, 2, 4, or 8
+	scale        uint8
+	displacement int64
+}
+
 type numberOf64Bits interface {
 	int64 | uint64 | float64
 }
@@ -47,8 +83,14 @@ type topLevelASTitem interface {
 	location() textLocation
 }
 
-func (_ comment) isTopLevelASTitem()            {}
-func (_ functionDefinition) isTopLevelASTitem() {}
+func (_ comment) isTopLevelASTitem()                  {}
+func (_ functionDefinition) isTopLevelASTitem()       {}
+func (_ constantDefinition) isTopLevelASTitem()       {}
+func (_ globalVariableDefinition) isTopLevelASTitem() {}
+func (_ bufferDefinition) isTopLevelASTitem()         {}
+func (_ structDefinition) isTopLevelASTitem()         {}
+func (_ enumDefinition) isTopLevelASTitem()           {}
+func (_ importStatement) isTopLevelASTitem()          {}
 
 // Any AST item that can be a statement like a function call, or a comment
 type statement interface {
@@ -64,6 +106,7 @@ func (_ returnStatement) isStatementASTitem()       {}
 func (_ breakStatement) isStatementASTitem()        {}
 func (_ continueStatement) isStatementASTitem()     {}
 func (_ dropVariableStatement) isStatementASTitem() {}
+func (_ deferStatement) isStatementASTitem()        {}
 
 // Any AST item that can be easily converted into the source operand for assembly's `mov`
 // instruction.
@@ -72,10 +115,14 @@ type rawValue interface {
 	location() textLocation
 }
 
-func (_ variableValue) isRawValue()    {}
-func (_ numberValue[any]) isRawValue() {}
-func (_ stringValue) isRawValue()      {}
-func (_ characterValue) isRawValue()   {}
+func (_ variableValue) isRawValue()        {}
+func (_ numberValue[any]) isRawValue()     {}
+func (_ stringValue) isRawValue()          {}
+func (_ characterValue) isRawValue()       {}
+func (_ lengthValue) isRawValue()          {}
+func (_ arithmeticExpression) isRawValue() {}
+func (_ addressValue) isRawValue()         {}
+func (_ structSizeValue) isRawValue()      {}
 
 // Any AST item that evaluates to either true or false
 type condition interface {
@@ -86,6 +133,7 @@ type condition interface {
 func (_ comparison) isCondition()   {}
 func (_ boolean) isCondition()      {}
 func (_ booleanValue) isCondition() {}
+func (_ notCondition) isCondition() {}
 
 // Mutation operation
 type mutationOperation interface {
@@ -101,6 +149,12 @@ func (_ incrementByRawValue) isMutationOperation()    {}
 func (_ decrementByRawValue) isMutationOperation()    {}
 func (_ multiplyByRawValue) isMutationOperation()     {}
 func (_ divideByRawValue) isMutationOperation()       {}
+func (_ andByRawValue) isMutationOperation()          {}
+func (_ orByRawValue) isMutationOperation()           {}
+func (_ xorByRawValue) isMutationOperation()          {}
+func (_ shiftLeftByRawValue) isMutationOperation()    {}
+func (_ shiftRightByRawValue) isMutationOperation()   {}
+func (_ setToNotOfRawValue) isMutationOperation()     {}
 
 // INDIVIDUAL AST ITEMS //
 // ==================== //
@@ -127,17 +181,47 @@ type numberValue[numberType numberOf64Bits] struct {
 }
 
 // Each character must be representable in 64 bits, since we assume that you can directly set
-// registers to characters.
+// registers to characters. `value` has any escape sequences decoded.
 type characterValue struct {
 	textLocation
 	value string
 }
 
+// `value` has any escape sequences decoded
 type stringValue struct {
 	textLocation
 	value string
 }
 
+// The number of bytes in a value that is known at compile time, for example `len("Hello")`
+type lengthValue struct {
+	textLocation
+	value rawValue
+}
+
+// The number of bytes in a struct, for example `sizeof(Point)`
+type structSizeValue struct {
+	textLocation
+	structName string
+}
+
+// The address of a global variable or buffer. This is not created by the parser, and instead
+// replaces the name of a global variable or buffer when constants are substituted.
+type addressValue struct {
+	textLocation
+	label string
+}
+
+// A value that is calculated from two other values, for example `width * height`. `textLocation`
+// is the location of the operator, and `operator` is one of +, -, *, /, %, &, |, xor, <<, >>, or
+// >>>.
+type arithmeticExpression struct {
+	textLocation
+	operator string
+	left     rawValue
+	right    rawValue
+}
+
 // A variable that is used as a value
 type variableValue struct {
 	textLocation
@@ -145,6 +229,16 @@ type variableValue struct {
 	variableIsDropped bool
 	// The number of times to modify the value the register points to rather then the register itself
 	pointerDereferenceLayers uint
+	// The size of the memory that is read if `pointerDereferenceLayers` is more then 0
+	dereferenceSize memoryAccessSize
+	// What is added to the variable before it is dereferenced, for example `index` in `list[index]`
+	offset memoryOffset
+	// The field that is read when the variable points to a struct, for example `x` in `point.x`, or a
+	// blank string if no field is read
+	field string
+	// The struct that the variable points to or the enum that the variable stores if it is given
+	// where the variable is defined, for example `Point` in `r1=point: Point`
+	typeName string
 }
 
 type registerAndRawValueAndLocation struct {
@@ -161,12 +255,78 @@ type functionDefinition struct {
 	body             []statement
 }
 
+// Makes the definitions in a module of the standard library available, for example `import arena`
+type importStatement struct {
+	textLocation
+	module string
+}
+
+// A value with a name that is known at compile time, for example `const PAGE_SIZE = 4096`. `value`
+// can be an arithmetic expression that uses other constants.
+type constantDefinition struct {
+	textLocation
+	name  string
+	value rawValue
+}
+
+// A global variable, for example `var counter: u64 = 0`. `value` is nil if the variable starts as 0.
+type globalVariableDefinition struct {
+	textLocation
+	name  string
+	size  memoryAccessSize
+	value rawValue
+}
+
+// A global list of bytes that all start as 0, for example `buffer inputBuffer[4096]`
+type bufferDefinition struct {
+	textLocation
+	name   string
+	length rawValue
+}
+
+// A list of fields that are stored next to each other in memory, for example
+// `struct Point { x: i64, y: i64 }`
+type structDefinition struct {
+	textLocation
+	name   string
+	fields []structFieldDefinition
+}
+
+type structFieldDefinition struct {
+	textLocation
+	name string
+	size memoryAccessSize
+}
+
+// A list of names for the values that a register can store, for example
+// `enum Color { Red, Green, Blue }`. Each variant is a constant that is its index in `variants`.
+type enumDefinition struct {
+	textLocation
+	name     string
+	variants []enumVariantDefinition
+}
+
+type enumVariantDefinition struct {
+	textLocation
+	name string
+}
+
 type variableMutationDestination struct {
 	textLocation
 	register Register
 	name     string
 	// The number of times to modify the value the register points to rather then the register itself
 	pointerDereferenceLayers uint
+	// The size of the memory that is written if `pointerDereferenceLayers` is more then 0
+	dereferenceSize memoryAccessSize
+	// What is added to the variable before it is dereferenced, for example `index` in `list[index]`
+	offset memoryOffset
+	// The field that is written when the variable points to a struct, for example `x` in `point.x`,
+	// or a blank string if no field is written
+	field string
+	// The struct that the variable points to or the enum that the variable stores if it is given
+	// where the variable is defined, for example `Point` in `r1 point: Point = ...`
+	typeName string
 }
 
 // A statement that mutates a variable/register
@@ -181,17 +341,30 @@ type dropVariableStatement struct {
 	variable string
 }
 
+// Code that runs whenever the block that the statement is in is exited, for example
+// `defer { r0 = ignore sysClose(r5=file) }`
+type deferStatement struct {
+	textLocation
+	block []statement
+}
+
 type ifElseStatement struct {
 	textLocation
 	condition condition
 	ifBlock   []statement
 	elseBlock []statement
+	// The location of the `else` or `elif` keyword. This is `textLocation{}` if there is no else
+	// block.
+	elseBlockLocation textLocation
 }
 
 type whileLoop struct {
 	textLocation
 	condition condition
 	loopBody  []statement
+	// The name that `break` and `continue` can use to refer to this loop. This is a blank string if
+	// the loop does not have a name.
+	label string
 }
 
 type returnStatement struct {
@@ -199,11 +372,17 @@ type returnStatement struct {
 	returnedValues []registerAndRawValueAndLocation
 }
 
-type breakStatement textLocation
-type continueStatement textLocation
+// `label` is the name of the loop to break out of, or a blank string for the innermost loop
+type breakStatement struct {
+	textLocation
+	label string
+}
 
-func (statement breakStatement) location() textLocation    { return textLocation(statement) }
-func (statement continueStatement) location() textLocation { return textLocation(statement) }
+// `label` is the name of the loop to continue, or a blank string for the innermost loop
+type continueStatement struct {
+	textLocation
+	label string
+}
 
 type comparison struct {
 	textLocation
@@ -218,6 +397,12 @@ type boolean struct {
 	conditions       []condition
 }
 
+// A condition that is true when `condition` is false, for example `not a == b`
+type notCondition struct {
+	textLocation
+	condition condition
+}
+
 type incrementBy1 struct{ textLocation }
 type decrementBy1 struct{ textLocation }
 
@@ -225,6 +410,9 @@ type setToFunctionCallValue struct {
 	textLocation
 	functionName string
 	functionArgs []registerAndRawValueAndLocation
+	// Whether `ignore` was written before the function name, which means that the result of a
+	// built-in function that can fail does not have to be checked
+	resultIsIgnored bool
 }
 
 type setToRawValue struct{ val rawValue }
@@ -232,9 +420,29 @@ type incrementByRawValue struct{ val rawValue }
 type decrementByRawValue struct{ val rawValue }
 type multiplyByRawValue struct{ val rawValue }
 type divideByRawValue struct{ val rawValue }
+type andByRawValue struct{ val rawValue }
+type orByRawValue struct{ val rawValue }
+type xorByRawValue struct{ val rawValue }
+type shiftLeftByRawValue struct{ val rawValue }
+
+// Shifts right by `val` bits. If `isArithmetic` is true, then the sign bit is copied into the bits
+// that are shifted in, otherwise zeros are shifted in.
+type shiftRightByRawValue struct {
+	val          rawValue
+	isArithmetic bool
+}
 
-func (operation setToRawValue) location() textLocation       { return operation.val.location() }
-func (operation incrementByRawValue) location() textLocation { return operation.val.location() }
-func (operation decrementByRawValue) location() textLocation { return operation.val.location() }
-func (operation multiplyByRawValue) location() textLocation  { return operation.val.location() }
-func (operation divideByRawValue) location() textLocation    { return operation.val.location() }
+// Sets the destination to the bitwise not of `val`
+type setToNotOfRawValue struct{ val rawValue }
+
+func (operation setToRawValue) location() textLocation        { return operation.val.location() }
+func (operation incrementByRawValue) location() textLocation  { return operation.val.location() }
+func (operation decrementByRawValue) location() textLocation  { return operation.val.location() }
+func (operation multiplyByRawValue) location() textLocation   { return operation.val.location() }
+func (operation divideByRawValue) location() textLocation     { return operation.val.location() }
+func (operation andByRawValue) location() textLocation        { return operation.val.location() }
+func (operation orByRawValue) location() textLocation         { return operation.val.location() }
+func (operation xorByRawValue) location() textLocation        { return operation.val.location() }
+func (operation shiftLeftByRawValue) location() textLocation  { return operation.val.location() }
+func (operation shiftRightByRawValue) location() textLocation { return operation.val.location() }
+func (operation setToNotOfRawValue) location() textLocation   { return operation.val.location() }
@@ -0,0 +1,462 @@
+package main
+
+// builtins.go
+// ===========
+// Responsible for the table of built-in functions, which are the functions that are compiled into
+// instructions instead of being defined in common assembly. The compiler reads the table to compile
+// calls to built-in functions, and `go generate` rewrites the list of syscalls in docs.md from it.
+// Users can add their own built-in functions by loading a table from a JSON file.
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// A platform that common assembly can be compiled for
+type target uint8
+
+const (
+	x86_64Linux target = iota
+)
+
+// The name of each target in a file of built-in functions
+var targetNames = map[string]target{
+	"x86_64-linux": x86_64Linux,
+}
+
+// The platform that code is compiled for
+const compilationTarget = x86_64Linux
+
+// An argument or return value of a built-in function
+type builtinValue struct {
+	register Register
+	name     string
+	typeName string
+}
+
+type builtinFunction struct {
+	name string
+	// A description of what the function does, which is put in the docs after the signature
+	docs string
+	// The instructions that call the function for each target that it is available on
+	instructions map[target]string
+	arguments    []builtinValue
+	// The number of arguments at the end of `arguments` that do not have to be given
+	optionalArguments int
+	// The registers that the function mutates, which are the registers that it returns values in
+	returnValues []builtinValue
+	// Whether the function returns a negative error number in r0 when it fails. The result of a
+	// function that can fail has to be checked, unless `ignore` is written before the function name.
+	canFail bool
+	// The registers that the function overwrites without returning a value in them, so they cannot
+	// store a variable when the function is called, and the surrounding function has to mutate them
+	clobberedRegisters []Register
+}
+
+// The registers that the kernel overwrites during a syscall, which are rcx and r11 on x86-64
+var syscallClobberedRegisters = []Register{2, 9}
+
+// The built-in functions, in the order that they are listed in the docs
+//
+//go:generate go test -run TestBuiltinFunctionsAreDocumented -update-docs
+var builtinFunctions = []builtinFunction{
+	{
+		name:               "sysRead",
+		docs:               "reads up to `numberOfCharacters` bytes from a file into `buffer`, and returns the number of bytes that were read",
+		instructions:       map[target]string{x86_64Linux: "movq $0, %rax\nsyscall"},
+		arguments:          []builtinValue{{5, "fileDescriptor", "i64"}, {4, "buffer", "pointer"}, {3, "numberOfCharacters", "i64"}},
+		returnValues:       []builtinValue{{0, "exitCode", "i64"}},
+		canFail:            true,
+		clobberedRegisters: syscallClobberedRegisters,
+	},
+	{
+		name:               "sysWrite",
+		docs:               "writes `numberOfCharacters` bytes from `text` to a file, and returns the number of bytes that were written",
+		instructions:       map[target]string{x86_64Linux: "movq $1, %rax\nsyscall"},
+		arguments:          []builtinValue{{5, "fileDescriptor", "i64"}, {4, "text", "pointer"}, {3, "numberOfCharacters", "i64"}},
+		returnValues:       []builtinValue{{0, "exitCode", "i64"}},
+		canFail:            true,
+		clobberedRegisters: syscallClobberedRegisters,
+	},
+	{
+		name:               "sysOpen",
+		docs:               "opens the file with the null terminated name `fileName`",
+		instructions:       map[target]string{x86_64Linux: "movq $2, %rax\nsyscall"},
+		arguments:          []builtinValue{{5, "fileName", "pointer"}, {4, "flags", "i64"}, {3, "mode", "i64"}},
+		returnValues:       []builtinValue{{0, "fileDescriptor", "i64"}},
+		canFail:            true,
+		clobberedRegisters: syscallClobberedRegisters,
+	},
+	{
+		name:               "sysClose",
+		docs:               "closes a file",
+		instructions:       map[target]string{x86_64Linux: "movq $3, %rax\nsyscall"},
+		arguments:          []builtinValue{{5, "fileDescriptor", "i64"}},
+		returnValues:       []builtinValue{{0, "exitCode", "i64"}},
+		canFail:            true,
+		clobberedRegisters: syscallClobberedRegisters,
+	},
+	{
+		name:               "sysFstat",
+		docs:               "writes information about a file to `stat`",
+		instructions:       map[target]string{x86_64Linux: "movq $5, %rax\nsyscall"},
+		arguments:          []builtinValue{{5, "fileDescriptor", "i64"}, {4, "stat", "pointer"}},
+		returnValues:       []builtinValue{{0, "exitCode", "i64"}},
+		canFail:            true,
+		clobberedRegisters: syscallClobberedRegisters,
+	},
+	{
+		name:               "sysLseek",
+		docs:               "moves the position in a file that is read from and written to next",
+		instructions:       map[target]string{x86_64Linux: "movq $8, %rax\nsyscall"},
+		arguments:          []builtinValue{{5, "fileDescriptor", "i64"}, {4, "offset", "i64"}, {3, "whence", "i64"}},
+		returnValues:       []builtinValue{{0, "offset", "i64"}},
+		canFail:            true,
+		clobberedRegisters: syscallClobberedRegisters,
+	},
+	{
+		name:               "sysMmap",
+		docs:               "maps `length` bytes of memory into the addresses of the program",
+		instructions:       map[target]string{x86_64Linux: "movq $9, %rax\nsyscall"},
+		arguments:          []builtinValue{{5, "address", "pointer"}, {4, "length", "i64"}, {3, "protection", "i64"}, {8, "flags", "i64"}, {6, "fileDescriptor", "i64"}, {7, "offset", "i64"}},
+		returnValues:       []builtinValue{{0, "address", "pointer"}},
+		canFail:            true,
+		clobberedRegisters: syscallClobberedRegisters,
+	},
+	{
+		name:               "sysMunmap",
+		docs:               "unmaps `length` bytes of memory that were mapped with `sysMmap`",
+		instructions:       map[target]string{x86_64Linux: "movq $11, %rax\nsyscall"},
+		arguments:          []builtinValue{{5, "address", "pointer"}, {4, "length", "i64"}},
+		returnValues:       []builtinValue{{0, "exitCode", "i64"}},
+		canFail:            true,
+		clobberedRegisters: syscallClobberedRegisters,
+	},
+	{
+		name:               "sysBrk",
+		docs:               "moves the end of the heap of the program to `newBreak`, and returns the new end of the heap",
+		instructions:       map[target]string{x86_64Linux: "movq $12, %rax\nsyscall"},
+		arguments:          []builtinValue{{5, "newBreak", "i64"}},
+		returnValues:       []builtinValue{{0, "exitCode", "i64"}},
+		clobberedRegisters: syscallClobberedRegisters,
+	},
+	{
+		name:               "sysPipe",
+		docs:               "creates a pipe, and writes the file descriptors for the ends of it to `fileDescriptors`",
+		instructions:       map[target]string{x86_64Linux: "movq $22, %rax\nsyscall"},
+		arguments:          []builtinValue{{5, "fileDescriptors", "pointer"}},
+		returnValues:       []builtinValue{{0, "exitCode", "i64"}},
+		canFail:            true,
+		clobberedRegisters: syscallClobberedRegisters,
+	},
+	{
+		name:               "sysDup2",
+		docs:               "makes `newFileDescriptor` refer to the same file as `oldFileDescriptor`",
+		instructions:       map[target]string{x86_64Linux: "movq $33, %rax\nsyscall"},
+		arguments:          []builtinValue{{5, "oldFileDescriptor", "i64"}, {4, "newFileDescriptor", "i64"}},
+		returnValues:       []builtinValue{{0, "fileDescriptor", "i64"}},
+		canFail:            true,
+		clobberedRegisters: syscallClobberedRegisters,
+	},
+	{
+		name:               "sysNanosleep",
+		docs:               "pauses the program for `duration`",
+		instructions:       map[target]string{x86_64Linux: "movq $35, %rax\nsyscall"},
+		arguments:          []builtinValue{{5, "duration", "pointer"}, {4, "remaining", "pointer"}},
+		returnValues:       []builtinValue{{0, "exitCode", "i64"}},
+		canFail:            true,
+		clobberedRegisters: syscallClobberedRegisters,
+	},
+	{
+		name:               "sysGetpid",
+		docs:               "returns the ID of the process",
+		instructions:       map[target]string{x86_64Linux: "movq $39, %rax\nsyscall"},
+		arguments:          []builtinValue{},
+		returnValues:       []builtinValue{{0, "processId", "i64"}},
+		clobberedRegisters: syscallClobberedRegisters,
+	},
+	{
+		name:               "sysSocket",
+		docs:               "creates a socket",
+		instructions:       map[target]string{x86_64Linux: "movq $41, %rax\nsyscall"},
+		arguments:          []builtinValue{{5, "domain", "i64"}, {4, "type", "i64"}, {3, "protocol", "i64"}},
+		returnValues:       []builtinValue{{0, "fileDescriptor", "i64"}},
+		canFail:            true,
+		clobberedRegisters: syscallClobberedRegisters,
+	},
+	{
+		name:               "sysConnect",
+		docs:               "connects a socket to `address`",
+		instructions:       map[target]string{x86_64Linux: "movq $42, %rax\nsyscall"},
+		arguments:          []builtinValue{{5, "fileDescriptor", "i64"}, {4, "address", "pointer"}, {3, "addressLength", "i64"}},
+		returnValues:       []builtinValue{{0, "exitCode", "i64"}},
+		canFail:            true,
+		clobberedRegisters: syscallClobberedRegisters,
+	},
+	{
+		name:               "sysAccept",
+		docs:               "waits for a connection to a listening socket, and returns a socket for that connection",
+		instructions:       map[target]string{x86_64Linux: "movq $43, %rax\nsyscall"},
+		arguments:          []builtinValue{{5, "fileDescriptor", "i64"}, {4, "address", "pointer"}, {3, "addressLength", "pointer"}},
+		returnValues:       []builtinValue{{0, "fileDescriptor", "i64"}},
+		canFail:            true,
+		clobberedRegisters: syscallClobberedRegisters,
+	},
+	{
+		name:               "sysSendto",
+		docs:               "sends `length` bytes from `buffer` through a socket",
+		instructions:       map[target]string{x86_64Linux: "movq $44, %rax\nsyscall"},
+		arguments:          []builtinValue{{5, "fileDescriptor", "i64"}, {4, "buffer", "pointer"}, {3, "length", "i64"}, {8, "flags", "i64"}, {6, "address", "pointer"}, {7, "addressLength", "i64"}},
+		returnValues:       []builtinValue{{0, "bytesSent", "i64"}},
+		canFail:            true,
+		clobberedRegisters: syscallClobberedRegisters,
+	},
+	{
+		name:               "sysRecvfrom",
+		docs:               "receives up to `length` bytes from a socket into `buffer`",
+		instructions:       map[target]string{x86_64Linux: "movq $45, %rax\nsyscall"},
+		arguments:          []builtinValue{{5, "fileDescriptor", "i64"}, {4, "buffer", "pointer"}, {3, "length", "i64"}, {8, "flags", "i64"}, {6, "address", "pointer"}, {7, "addressLength", "pointer"}},
+		returnValues:       []builtinValue{{0, "bytesReceived", "i64"}},
+		canFail:            true,
+		clobberedRegisters: syscallClobberedRegisters,
+	},
+	{
+		name:               "sysShutdown",
+		docs:               "stops a socket from sending and/or receiving",
+		instructions:       map[target]string{x86_64Linux: "movq $48, %rax\nsyscall"},
+		arguments:          []builtinValue{{5, "fileDescriptor", "i64"}, {4, "how", "i64"}},
+		returnValues:       []builtinValue{{0, "exitCode", "i64"}},
+		canFail:            true,
+		clobberedRegisters: syscallClobberedRegisters,
+	},
+	{
+		name:               "sysBind",
+		docs:               "gives a socket the address `address`",
+		instructions:       map[target]string{x86_64Linux: "movq $49, %rax\nsyscall"},
+		arguments:          []builtinValue{{5, "fileDescriptor", "i64"}, {4, "address", "pointer"}, {3, "addressLength", "i64"}},
+		returnValues:       []builtinValue{{0, "exitCode", "i64"}},
+		canFail:            true,
+		clobberedRegisters: syscallClobberedRegisters,
+	},
+	{
+		name:               "sysListen",
+		docs:               "makes a socket listen for connections",
+		instructions:       map[target]string{x86_64Linux: "movq $50, %rax\nsyscall"},
+		arguments:          []builtinValue{{5, "fileDescriptor", "i64"}, {4, "backlog", "i64"}},
+		returnValues:       []builtinValue{{0, "exitCode", "i64"}},
+		canFail:            true,
+		clobberedRegisters: syscallClobberedRegisters,
+	},
+	{
+		name:               "sysSetsockopt",
+		docs:               "sets an option of a socket",
+		instructions:       map[target]string{x86_64Linux: "movq $54, %rax\nsyscall"},
+		arguments:          []builtinValue{{5, "fileDescriptor", "i64"}, {4, "level", "i64"}, {3, "option", "i64"}, {8, "value", "pointer"}, {6, "valueLength", "i64"}},
+		returnValues:       []builtinValue{{0, "exitCode", "i64"}},
+		canFail:            true,
+		clobberedRegisters: syscallClobberedRegisters,
+	},
+	{
+		name:               "sysFork",
+		docs:               "creates a copy of the process, and returns 0 in the copy and the ID of the copy in the original",
+		instructions:       map[target]string{x86_64Linux: "movq $57, %rax\nsyscall"},
+		arguments:          []builtinValue{},
+		returnValues:       []builtinValue{{0, "processId", "i64"}},
+		canFail:            true,
+		clobberedRegisters: syscallClobberedRegisters,
+	},
+	{
+		name:               "sysExecve",
+		docs:               "replaces the process with the program at the null terminated path `fileName`",
+		instructions:       map[target]string{x86_64Linux: "movq $59, %rax\nsyscall"},
+		arguments:          []builtinValue{{5, "fileName", "pointer"}, {4, "arguments", "pointer"}, {3, "environmentVariables", "pointer"}},
+		returnValues:       []builtinValue{{0, "exitCode", "i64"}},
+		canFail:            true,
+		clobberedRegisters: syscallClobberedRegisters,
+	},
+	{
+		name:               "sysExit",
+		docs:               "exits the program with `status`",
+		instructions:       map[target]string{x86_64Linux: "movq $60, %rax\nsyscall"},
+		arguments:          []builtinValue{{5, "status", "i64"}},
+		returnValues:       []builtinValue{{0, "exitCode", "i64"}},
+		clobberedRegisters: syscallClobberedRegisters,
+	},
+	{
+		name:               "sysWait4",
+		docs:               "waits for a child process to change state",
+		instructions:       map[target]string{x86_64Linux: "movq $61, %rax\nsyscall"},
+		arguments:          []builtinValue{{5, "processId", "i64"}, {4, "status", "pointer"}, {3, "options", "i64"}, {8, "resourceUsage", "pointer"}},
+		returnValues:       []builtinValue{{0, "processId", "i64"}},
+		canFail:            true,
+		clobberedRegisters: syscallClobberedRegisters,
+	},
+	{
+		name:               "sysGetdents64",
+		docs:               "reads the entries of a directory into `buffer`",
+		instructions:       map[target]string{x86_64Linux: "movq $217, %rax\nsyscall"},
+		arguments:          []builtinValue{{5, "fileDescriptor", "i64"}, {4, "buffer", "pointer"}, {3, "length", "i64"}},
+		returnValues:       []builtinValue{{0, "bytesRead", "i64"}},
+		canFail:            true,
+		clobberedRegisters: syscallClobberedRegisters,
+	},
+	{
+		name:               "sysClockGettime",
+		docs:               "writes the current time of `clock` to `time`",
+		instructions:       map[target]string{x86_64Linux: "movq $228, %rax\nsyscall"},
+		arguments:          []builtinValue{{5, "clock", "i64"}, {4, "time", "pointer"}},
+		returnValues:       []builtinValue{{0, "exitCode", "i64"}},
+		canFail:            true,
+		clobberedRegisters: syscallClobberedRegisters,
+	},
+	{
+		name:         "sysCall",
+		docs:         "calls the syscall with the number `number`, which is useful for syscalls that do not have their own function. Any number of the arguments after `number` can be given",
+		instructions: map[target]string{x86_64Linux: "syscall"},
+		arguments: []builtinValue{
+			{0, "number", "i64"}, {5, "argument1", "i64"}, {4, "argument2", "i64"}, {3, "argument3", "i64"},
+			{8, "argument4", "i64"}, {6, "argument5", "i64"}, {7, "argument6", "i64"},
+		},
+		optionalArguments:  6,
+		returnValues:       []builtinValue{{0, "result", "i64"}},
+		canFail:            true,
+		clobberedRegisters: syscallClobberedRegisters,
+	},
+}
+
+// The built-in functions that were loaded from a file by `loadBuiltinFunctions`, which are not
+// listed in the docs
+var loadedBuiltinFunctions = []builtinFunction{}
+
+// Returns the built-in function called `name`, and whether it exists
+func findBuiltinFunction(name string) (builtinFunction, bool) {
+	for _, function := range append(builtinFunctions[:len(builtinFunctions):len(builtinFunctions)], loadedBuiltinFunctions...) {
+		if function.name == name {
+			return function, true
+		}
+	}
+	return builtinFunction{}, false
+}
+
+// The JSON format of an argument or return value in a file of built-in functions
+type builtinValueJSON struct {
+	Register Register `json:"register"`
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+}
+
+// The JSON format of a built-in function in a file of built-in functions. `Instructions` has the
+// instructions for each target, by the name of the target in `targetNames`.
+type builtinFunctionJSON struct {
+	Name               string             `json:"name"`
+	Docs               string             `json:"docs"`
+	Instructions       map[string]string  `json:"instructions"`
+	Arguments          []builtinValueJSON `json:"arguments"`
+	OptionalArguments  int                `json:"optionalArguments"`
+	ReturnValues       []builtinValueJSON `json:"returnValues"`
+	CanFail            bool               `json:"canFail"`
+	ClobberedRegisters []Register         `json:"clobberedRegisters"`
+}
+
+// Adds the built-in functions in `file`, which is a JSON list of built-in functions, to
+// `loadedBuiltinFunctions`
+func loadBuiltinFunctions(file []byte) error {
+	var functions []builtinFunctionJSON
+	decoder := json.NewDecoder(bytes.NewReader(file))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&functions); err != nil {
+		return err
+	}
+	for _, function := range functions {
+		loadedFunction, err := builtinFunctionFromJSON(function)
+		if err != nil {
+			return errors.New("In the built-in function `" + function.Name + "`: " + err.Error())
+		}
+		add(&loadedBuiltinFunctions, loadedFunction)
+	}
+	return nil
+}
+
+// Converts `function` from a file of built-in functions into a built-in function, and checks that
+// it is valid
+func builtinFunctionFromJSON(function builtinFunctionJSON) (builtinFunction, error) {
+	if function.Name == "" {
+		return builtinFunction{}, errors.New("Every built-in function needs a name")
+	}
+	if _, exists := findBuiltinFunction(function.Name); exists {
+		return builtinFunction{}, errors.New("There is already a built-in function with this name")
+	}
+	out := builtinFunction{
+		name:               function.Name,
+		docs:               function.Docs,
+		instructions:       make(map[target]string),
+		optionalArguments:  function.OptionalArguments,
+		canFail:            function.CanFail,
+		clobberedRegisters: function.ClobberedRegisters,
+	}
+	for targetName, instructions := range function.Instructions {
+		target, exists := targetNames[targetName]
+		if !exists {
+			return builtinFunction{}, errors.New("There is no target called `" + targetName + "`")
+		}
+		out.instructions[target] = instructions
+	}
+	var err error
+	out.arguments, err = builtinValuesFromJSON(function.Arguments)
+	if err != nil {
+		return builtinFunction{}, err
+	}
+	out.returnValues, err = builtinValuesFromJSON(function.ReturnValues)
+	if err != nil {
+		return builtinFunction{}, err
+	}
+	for _, register := range out.clobberedRegisters {
+		if register < 0 || register > 15 {
+			return builtinFunction{}, errors.New("It clobbers r" + fmt.Sprint(register) + ", which does not exist")
+		}
+	}
+	if out.optionalArguments < 0 || out.optionalArguments > len(out.arguments) {
+		return builtinFunction{}, errors.New("It has " + fmt.Sprint(out.optionalArguments) +
+			" optional arguments, but only " + fmt.Sprint(len(out.arguments)) + " arguments")
+	}
+	if out.canFail && (len(out.returnValues) == 0 || out.returnValues[0].register != 0) {
+		return builtinFunction{}, errors.New("It can fail, so its first return value has to be in r0")
+	}
+	return out, nil
+}
+
+// Converts the arguments or return values of a function from a file of built-in functions
+func builtinValuesFromJSON(values []builtinValueJSON) ([]builtinValue, error) {
+	out := []builtinValue{}
+	for _, value := range values {
+		if value.Register < 0 || value.Register > 15 {
+			return nil, errors.New("`" + value.Name + "` uses r" + fmt.Sprint(value.Register) + ", which does not exist")
+		}
+		add(&out, builtinValue{register: value.Register, name: value.Name, typeName: value.Type})
+	}
+	return out, nil
+}
+
+// Returns the signature of `function` in the same format as the head of a function definition,
+// for example `r0 exitCode: i64 = sysClose (r5=fileDescriptor: i64)`
+func (function builtinFunction) signature() string {
+	returnValues := mapList(function.returnValues, func(value builtinValue) string {
+		return "r" + fmt.Sprint(value.register) + " " + value.name + ": " + value.typeName
+	})
+	arguments := mapList(function.arguments, func(value builtinValue) string {
+		return "r" + fmt.Sprint(value.register) + "=" + value.name + ": " + value.typeName
+	})
+	return strings.Join(returnValues, ", ") + " = " + function.name + " (" + strings.Join(arguments, ", ") + ")"
+}
+
+// Generates the markdown list of built-in functions that is in the docs
+func builtinFunctionsDocs() string {
+	out := ""
+	for _, function := range builtinFunctions {
+		out += "- `" + function.signature() + "` " + function.docs + ".\n"
+	}
+	return out
+}
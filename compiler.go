@@ -1,9 +1,14 @@
 package main
 
 import (
+	"cmp"
 	"errors"
 	"fmt"
+	"maps"
+	"math"
 	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 )
 
@@ -34,6 +39,11 @@ type individualRegisterState struct {
 	// mutable is not mutated. If registerWasDefinedAsMutableAt == textLocation{}, then this
 	// register was not defined as mutable.
 	registerWasDefinedAsMutableAt textLocation
+
+	// If this register might store a pointer to memory that cannot be written to, like the memory of
+	// a string value, then this is the location of the value that the pointer came from. Otherwise
+	// this is textLocation{}.
+	pointsToReadOnlyDataFrom textLocation
 }
 
 type registerState struct {
@@ -77,12 +87,159 @@ func commonAssemblyRegisterToX86Register(registerIndex Register) string {
 	case 14:
 		return "%rsp"
 	case 15:
-		return "%ebp"
+		return "%rbp"
 	default:
 		panic("The number " + fmt.Sprint(registerIndex) + " does not correspond to an X86-64 register")
 	}
 }
 
+// The names of the x86-64 registers that contain the lowest 8, 16, and 32 bits of each common
+// assembly register
+var smallerX86RegisterNames = [16][3]string{
+	{"%al", "%ax", "%eax"},
+	{"%bl", "%bx", "%ebx"},
+	{"%cl", "%cx", "%ecx"},
+	{"%dl", "%dx", "%edx"},
+	{"%sil", "%si", "%esi"},
+	{"%dil", "%di", "%edi"},
+	{"%r8b", "%r8w", "%r8d"},
+	{"%r9b", "%r9w", "%r9d"},
+	{"%r10b", "%r10w", "%r10d"},
+	{"%r11b", "%r11w", "%r11d"},
+	{"%r12b", "%r12w", "%r12d"},
+	{"%r13b", "%r13w", "%r13d"},
+	{"%r14b", "%r14w", "%r14d"},
+	{"%r15b", "%r15w", "%r15d"},
+	{"%spl", "%sp", "%esp"},
+	{"%bpl", "%bp", "%ebp"},
+}
+
+// Converts a common assembly register into the x86-64 register that contains its lowest `bits` bits
+func commonAssemblyRegisterToSizedX86Register(registerIndex Register, bits uint8) string {
+	switch bits {
+	case 8:
+		return smallerX86RegisterNames[registerIndex][0]
+	case 16:
+		return smallerX86RegisterNames[registerIndex][1]
+	case 32:
+		return smallerX86RegisterNames[registerIndex][2]
+	case 64:
+		return commonAssemblyRegisterToX86Register(registerIndex)
+	default:
+		panic("There is no x86-64 register with " + fmt.Sprint(bits) + " bits")
+	}
+}
+
+// Returns the suffix that tells the assembler how many bits an instruction uses
+func instructionSuffix(bits uint8) string {
+	switch bits {
+	case 8:
+		return "b"
+	case 16:
+		return "w"
+	case 32:
+		return "l"
+	case 64:
+		return "q"
+	default:
+		panic("There is no x86-64 instruction suffix for " + fmt.Sprint(bits) + " bits")
+	}
+}
+
+// Returns the size of the memory that `value` reads. Values that are not read from memory are 64
+// bits.
+func sizeOfValue(value rawValue) memoryAccessSize {
+	variable, isVariable := value.(variableValue)
+	if isVariable && variable.pointerDereferenceLayers > 0 {
+		return variable.dereferenceSize
+	}
+	return memoryAccessSize{bits: 64}
+}
+
+// Returns the size of the memory that `destination` writes. Registers are 64 bits.
+func sizeOfDestination(destination variableMutationDestination) memoryAccessSize {
+	if destination.pointerDereferenceLayers > 0 {
+		return destination.dereferenceSize
+	}
+	return memoryAccessSize{bits: 64}
+}
+
+// Returns true if `value` is read from memory
+func valueIsMemory(value rawValue) bool {
+	variable, isVariable := value.(variableValue)
+	return isVariable && variable.pointerDereferenceLayers > 0
+}
+
+// Returns false if `operand` is a number that is too big to be used by x86-64 instructions other
+// then `movabs`, which are limited to 32 bit numbers that are sign extended to 64 bits
+func immediateFitsIn32Bits(operand string) bool {
+	if !strings.HasPrefix(operand, "$") {
+		return true
+	}
+	number, err := strconv.ParseInt(operand[1:], 10, 64)
+	return err != nil || (math.MinInt32 <= number && number <= math.MaxInt32)
+}
+
+// Returns the assembly that copies `source`, which is `size` big, into all 64 bits of `register`.
+// Values that are smaller then 64 bits are either zero extended or sign extended depending on
+// `size.isSigned`.
+func loadIntoRegister(source string, size memoryAccessSize, register Register) string {
+	if !immediateFitsIn32Bits(source) {
+		return "\nmovabsq " + source + ", " + commonAssemblyRegisterToX86Register(register)
+	}
+	if size.bits == 64 {
+		return "\nmovq " + source + ", " + commonAssemblyRegisterToX86Register(register)
+	}
+	if size.bits == 32 && !size.isSigned {
+		// Writing to the lowest 32 bits of a register sets the other bits to 0
+		return "\nmovl " + source + ", " + commonAssemblyRegisterToSizedX86Register(register, 32)
+	}
+	extension := "z"
+	if size.isSigned {
+		extension = "s"
+	}
+	return "\nmov" + extension + instructionSuffix(size.bits) + "q " + source + ", " +
+		commonAssemblyRegisterToX86Register(register)
+}
+
+// Returns true if `value` is a number that is in the range of numbers that memory of `size` can store
+func numberIsInRange(value rawValue, size memoryAccessSize) bool {
+	if size.bits == 64 {
+		return false
+	}
+	switch number := value.(type) {
+	case numberValue[uint64]:
+		if size.isSigned {
+			return number.value < 1<<(size.bits-1)
+		}
+		return number.value < 1<<size.bits
+	case numberValue[int64]:
+		if size.isSigned {
+			return -(1<<(size.bits-1)) <= number.value && number.value < 1<<(size.bits-1)
+		}
+		return 0 <= number.value && number.value < 1<<size.bits
+	case characterValue:
+		return numberIsInRange(numberValue[uint64]{value: characterToNumber(number.value)}, size)
+	}
+	return false
+}
+
+// Returns false if `value` is a number that cannot be stored in `bits` bits
+func numberFitsInBits(value rawValue, bits uint8) bool {
+	if bits == 64 {
+		return true
+	}
+	switch number := value.(type) {
+	case numberValue[uint64]:
+		return number.value < 1<<bits
+	case numberValue[int64]:
+		return number.value >= -(1 << (bits - 1))
+	case characterValue:
+		return characterToNumber(number.value) < 1<<bits
+	}
+	return true
+}
+
 type compiledFunction struct {
 	references uint
 	jumpLabel  string
@@ -95,8 +252,19 @@ type compiledFunction struct {
 type compilerState struct {
 	numberOfJumps              uint
 	numberOfItemsInDataSection uint
-	dataSection                string
-	compiledFunctions          map[string]compiledFunction
+	// String values, which cannot be written to
+	readOnlyDataSection string
+	// The label of each string value in `readOnlyDataSection`, so that a string that is used more
+	// then once is only stored once
+	stringLabels      map[string]string
+	compiledFunctions map[string]compiledFunction
+	// The names of the functions in `compiledFunctions` in the order that they were compiled in, so
+	// that the generated assembly is always in the same order
+	compiledFunctionNames []string
+	// Global variables that do not start as 0
+	initialisedDataSection string
+	// Global variables and buffers that start as 0, which take up no space in the executable
+	zeroedDataSection string
 }
 
 func (state *compilerState) createNewJumpLabel() string {
@@ -109,12 +277,77 @@ func (state *compilerState) createNewDataSectionLabel() string {
 	return "dataSectionLabel" + fmt.Sprint(state.numberOfItemsInDataSection)
 }
 
-// Stores the assembly code to be inserted when a control flow keyword is used.
-// If the assembly code is a blank string, then that control flow cannot be used
-// in the current scope.
+// Stores the assembly code to be inserted when a control flow keyword is used inside of a loop.
+// The code being compiled has a slice of these, with one item for each loop that the code is in,
+// and the innermost loop last. If the slice is empty, then no control flow keywords can be used in
+// the current scope.
 type assemblyForControlFlowKeywords struct {
+	// The name of the loop, or a blank string if the loop does not have a name
+	label            string
+	loopLocation     textLocation
 	continueAssembly string
 	breakAssembly    string
+	// The number of items in the deferred code of the scope that the loop is in, so that `break` and
+	// `continue` only run the code that is deferred inside of the loop
+	numberOfDeferredBlocks int
+	// The read-only data that each register might point to at a `break` or `continue` statement in
+	// the loop
+	readOnlyDataAtBreaks    *readOnlyDataPointers
+	readOnlyDataAtContinues *readOnlyDataPointers
+}
+
+// The location of the read-only data that each register might point to, or textLocation{} for the
+// registers that cannot point to read-only data
+type readOnlyDataPointers [16]textLocation
+
+// Adds the read-only data that each register in `regState` might point to
+func (pointers *readOnlyDataPointers) addFrom(regState registerState) {
+	for register, registerState := range regState.registers {
+		if pointers[register].line == 0 {
+			pointers[register] = registerState.pointsToReadOnlyDataFrom
+		}
+	}
+}
+
+// Marks each register in `regState` that might point to read-only data in `pointers` as pointing to
+// it. Returns true if any register did not already point to read-only data.
+func (pointers readOnlyDataPointers) addTo(regState *registerState) bool {
+	changed := false
+	for register, location := range pointers {
+		if location.line != 0 && regState.registers[register].pointsToReadOnlyDataFrom.line == 0 {
+			regState.registers[register].pointsToReadOnlyDataFrom = location
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Finds the loop that a `break` or `continue` statement refers to. If `label` is a blank string,
+// then this is the innermost loop, otherwise it is the innermost loop called `label`.
+func findLoopForControlFlowKeyword(
+	loops []assemblyForControlFlowKeywords,
+	keywordName string,
+	label string,
+	location textLocation,
+) (assemblyForControlFlowKeywords, codeParsingError) {
+	if label == "" {
+		if len(loops) == 0 {
+			return assemblyForControlFlowKeywords{}, codeParsingError{
+				msg:          errors.New("`" + keywordName + "` is not valid outside of a loop"),
+				textLocation: location,
+			}
+		}
+		return loops[len(loops)-1], codeParsingError{}
+	}
+	for i := len(loops) - 1; i >= 0; i-- {
+		if loops[i].label == label {
+			return loops[i], codeParsingError{}
+		}
+	}
+	return assemblyForControlFlowKeywords{}, codeParsingError{
+		msg:          errors.New("`" + keywordName + " " + label + "` is not inside of a loop called `" + label + "`"),
+		textLocation: location,
+	}
 }
 
 // Modifies the register states so that inner scope cannot drop variables defined in outer scope
@@ -127,31 +360,195 @@ func parseRegisterStatesToInnerScope(regState registerState) registerState {
 	return regState
 }
 
+// Returns false if the end of `block` can never be reached, because `block` always exits with a
+// return, break, or continue statement.
+func blockFallsThrough(block []statement) bool {
+	for i := len(block) - 1; i >= 0; i-- {
+		switch statement := block[i].(type) {
+		case comment:
+			continue
+		case returnStatement, breakStatement, continueStatement:
+			return false
+		case ifElseStatement:
+			return len(statement.elseBlock) == 0 ||
+				blockFallsThrough(statement.ifBlock) ||
+				blockFallsThrough(statement.elseBlock)
+		}
+		return true
+	}
+	return true
+}
+
+// The register state at the end of one branch of an if/elif/else statement
+type ifElseBranch struct {
+	// The location of the `if`, `elif`, or `else` keyword that starts the branch
+	location textLocation
+	// Whether this branch is the else branch that is implied when an if/elif statement does not
+	// have an else block
+	isImplicitElse bool
+	regState       registerState
+}
+
+// Merges the register states at the end of the branches of an if/elif/else statement into the
+// register state after the statement. `reachableBranches` should only contain the branches whose
+// end can be reached. Variables from outside the statement that are dropped in every branch are
+// dropped after the statement, and variables that are defined to use the same register in every
+// branch are still defined after the statement. Any other variables that are defined inside the
+// branches fall out of scope.
+func mergeIfElseBranches(regState registerState, reachableBranches []ifElseBranch) (registerState, []codeParsingError) {
+	if len(reachableBranches) == 0 {
+		// The code after the statement can never be reached
+		return regState, []codeParsingError{}
+	}
+
+	// Check that every variable from outside the statement is either dropped in every branch, or
+	// kept in every branch
+	errs := []codeParsingError{}
+	for register, outerVariable := range regState.registers {
+		if outerVariable.variableName == "" {
+			continue
+		}
+		branchesThatKeepTheVariable := []ifElseBranch{}
+		for _, branch := range reachableBranches {
+			if branch.regState.registers[register].variableName == outerVariable.variableName {
+				add(&branchesThatKeepTheVariable, branch)
+			}
+		}
+		if len(branchesThatKeepTheVariable) == len(reachableBranches) {
+			continue
+		}
+		for _, branch := range branchesThatKeepTheVariable {
+			msg := "`" + outerVariable.variableName + "` is dropped in another branch of this " +
+				"if/elif/else statement, but not in this branch. A variable that is defined outside " +
+				"an if/elif/else statement can only be dropped inside the statement if it is dropped " +
+				"in every branch."
+			if branch.isImplicitElse {
+				msg = "`" + outerVariable.variableName + "` is dropped in every branch of this " +
+					"if/elif statement, but the statement does not have an else branch. Add an else " +
+					"branch that also drops `" + outerVariable.variableName + "`."
+			}
+			add(&errs, codeParsingError{msg: errors.New(msg), textLocation: branch.location})
+		}
+	}
+	if len(errs) > 0 {
+		return registerState{}, errs
+	}
+
+	// Merge the registers. A register might point to read-only data after the statement if it might
+	// in any branch.
+	for register := range regState.registers {
+		mergedRegister := reachableBranches[0].regState.registers[register]
+		for _, branch := range reachableBranches[1:] {
+			if branch.regState.registers[register].variableName != mergedRegister.variableName {
+				mergedRegister.variableName = ""
+				mergedRegister.variableNameWasDefinedAt = textLocation{}
+				break
+			}
+		}
+		if mergedRegister.variableName == regState.registers[register].variableName {
+			mergedRegister = regState.registers[register]
+		}
+		mergedRegister.pointsToReadOnlyDataFrom = textLocation{}
+		for _, branch := range reachableBranches {
+			if location := branch.regState.registers[register].pointsToReadOnlyDataFrom; location.line != 0 {
+				mergedRegister.pointsToReadOnlyDataFrom = location
+				break
+			}
+		}
+		regState.registers[register] = mergedRegister
+	}
+	return regState, []codeParsingError{}
+}
+
+// Code from a `defer` statement that has to be compiled before the scope that it is in is exited
+type deferredCode struct {
+	location textLocation
+	block    []statement
+}
+
+// Compiles the code in `deferred` that runs when a scope is exited by `exit`, starting with the code
+// that was deferred last. The deferred code is compiled with the register state at the exit, so it
+// cannot use variables that are dropped before the exit.
+func (state *compilerState) compileDeferredCode(
+	deferred []deferredCode,
+	regState registerState,
+	siblingFunctions map[string]functionDefinition,
+	exit string,
+) (string, []codeParsingError) {
+	assembly := ""
+	for i := len(deferred) - 1; i >= 0; i-- {
+		deferredAssembly, _, errs := state.compileBlockToAssembly(deferred[i].block,
+			parseRegisterStatesToInnerScope(regState), siblingFunctions, nil, nil)
+		for j := range errs {
+			errs[j].msg = errors.New("When the code that is deferred at line " +
+				fmt.Sprint(deferred[i].location.line) + " and column " +
+				fmt.Sprint(deferred[i].location.column) + " runs " + exit + ": " + errs[j].msg.Error())
+		}
+		if len(errs) != 0 {
+			return "", errs
+		}
+		assembly += deferredAssembly
+	}
+	return assembly, []codeParsingError{}
+}
+
+// Describes the location of a statement that exits a scope, for the errors in deferred code
+func exitDescription(keywordName string, location textLocation) string {
+	return "at the `" + keywordName + "` at line " + fmt.Sprint(location.line) + " and column " +
+		fmt.Sprint(location.column)
+}
+
+// Compiles a block of statements into assembly. Also returns the register state at the end of the
+// block. `deferred` is the code that has been deferred in the scopes that the block is in, which
+// runs before `return` statements, and before `break` and `continue` statements that exit the scope
+// it was deferred in.
 func (state *compilerState) compileBlockToAssembly(
 	block []statement,
 	regState registerState,
 	siblingFunctions map[string]functionDefinition,
-	controlFlowKeywordsAssembly assemblyForControlFlowKeywords,
-) (string, []codeParsingError) {
+	loops []assemblyForControlFlowKeywords,
+	deferred []deferredCode,
+) (string, registerState, []codeParsingError) {
 	assembly := ""
+	numberOfDeferredBlocksOutsideBlock := len(deferred)
 	for index, genericStatement := range block {
 		switch statement := genericStatement.(type) {
 
 		case comment:
 
+		case deferStatement:
+			deferred = append(deferred[:len(deferred):len(deferred)], deferredCode{
+				location: statement.textLocation,
+				block:    statement.block,
+			})
+
 		case returnStatement:
 			assert(eq(index, len(block)-1))
+			deferredAssembly, errs := state.compileDeferredCode(deferred, regState, siblingFunctions,
+				exitDescription("return", statement.textLocation))
+			if len(errs) != 0 {
+				return "", registerState{}, errs
+			}
+			assembly += deferredAssembly
 			assemblyForArgs, returnRegisters, errs := state.compileFunctionCallArguments(statement.returnedValues, &regState, false)
 			if len(errs) != 0 {
-				return "", errs
+				return "", registerState{}, errs
 			}
 			err := checkRegisterListsAreTheSame(regState.functionReturnValueRegisters, returnRegisters)
 			if err.msg != nil {
-				return "", []codeParsingError{err}
+				return "", registerState{}, []codeParsingError{err}
 			}
-			return assembly + assemblyForArgs + "\n\\", []codeParsingError{}
+			return assembly + assemblyForArgs + "\n\\", regState, []codeParsingError{}
 
 		case mutationStatement:
+			err := checkForWritesToReadOnlyData(&regState, statement.destination)
+			if err.msg != nil {
+				return "", registerState{}, []codeParsingError{err}
+			}
+			readOnlyData := textLocation{}
+			if operation, isSetToRawValue := statement.operation.(setToRawValue); isSetToRawValue {
+				readOnlyData = readOnlyDataThatValuePointsTo(&regState, operation.val)
+			}
 			assemblyForStatement := ""
 			errs := []codeParsingError{}
 			switch operation := statement.operation.(type) {
@@ -162,15 +559,35 @@ func (state *compilerState) compileBlockToAssembly(
 			case decrementBy1:
 				assemblyForStatement, errs = state.compileVariableMutation("dec", nil, statement.destination, statement.textLocation, &regState)
 			case setToRawValue:
-				assemblyForStatement, errs = state.compileVariableMutation("mov", operation.val, statement.destination, statement.textLocation, &regState)
+				if expression, isExpression := operation.val.(arithmeticExpression); isExpression {
+					assemblyForStatement, errs = state.compileExpressionAssignment(expression, statement.destination, statement.textLocation, &regState)
+				} else {
+					assemblyForStatement, errs = state.compileVariableMutation("mov", operation.val, statement.destination, statement.textLocation, &regState)
+				}
 			case incrementByRawValue:
-				assemblyForStatement, errs = state.compileVariableMutation("add", operation.val, statement.destination, statement.textLocation, &regState)
+				assemblyForStatement, errs = state.compileVariableMutationByOperator("add", "+", operation.val, statement.destination, statement.textLocation, &regState)
 			case decrementByRawValue:
-				assemblyForStatement, errs = state.compileVariableMutation("sub", operation.val, statement.destination, statement.textLocation, &regState)
+				assemblyForStatement, errs = state.compileVariableMutationByOperator("sub", "-", operation.val, statement.destination, statement.textLocation, &regState)
 			case multiplyByRawValue:
-				assemblyForStatement, errs = state.compileVariableMutation("mul", operation.val, statement.destination, statement.textLocation, &regState)
+				assemblyForStatement, errs = state.compileVariableMutationByOperator("", "*", operation.val, statement.destination, statement.textLocation, &regState)
 			case divideByRawValue:
-				assemblyForStatement, errs = state.compileVariableMutation("div", operation.val, statement.destination, statement.textLocation, &regState)
+				assemblyForStatement, errs = state.compileVariableMutationByOperator("", "/", operation.val, statement.destination, statement.textLocation, &regState)
+			case andByRawValue:
+				assemblyForStatement, errs = state.compileVariableMutationByOperator("and", "&", operation.val, statement.destination, statement.textLocation, &regState)
+			case orByRawValue:
+				assemblyForStatement, errs = state.compileVariableMutationByOperator("or", "|", operation.val, statement.destination, statement.textLocation, &regState)
+			case xorByRawValue:
+				assemblyForStatement, errs = state.compileVariableMutationByOperator("xor", "xor", operation.val, statement.destination, statement.textLocation, &regState)
+			case shiftLeftByRawValue:
+				assemblyForStatement, errs = state.compileVariableMutationByOperator("shl", "<<", operation.val, statement.destination, statement.textLocation, &regState)
+			case shiftRightByRawValue:
+				instruction, operator := "shr", ">>>"
+				if operation.isArithmetic {
+					instruction, operator = "sar", ">>"
+				}
+				assemblyForStatement, errs = state.compileVariableMutationByOperator(instruction, operator, operation.val, statement.destination, statement.textLocation, &regState)
+			case setToNotOfRawValue:
+				assemblyForStatement, errs = state.compileVariableMutation("not", operation.val, statement.destination, statement.textLocation, &regState)
 			default:
 				panic("Unexpected internal state:\n" +
 					"- Expected `statement.operation.(type)` to be equal to either:\n" +
@@ -182,17 +599,37 @@ func (state *compilerState) compileBlockToAssembly(
 					"  - `decrementByRawValue`\n" +
 					"  - `multiplyByRawValue`\n" +
 					"  - `divideByRawValue`\n" +
+					"  - `andByRawValue`\n" +
+					"  - `orByRawValue`\n" +
+					"  - `xorByRawValue`\n" +
+					"  - `shiftLeftByRawValue`\n" +
+					"  - `shiftRightByRawValue`\n" +
+					"  - `setToNotOfRawValue`\n" +
 					"- But it equals `" + fmt.Sprint(reflect.TypeOf(statement.operation)) + "`\n" +
 					"- Context: `statement.line` is " + fmt.Sprint(statement.line) + "\n" +
 					"- Context: `statement.column` is " + fmt.Sprint(statement.column),
 				)
 			}
 			if len(errs) != 0 {
-				return "", errs
+				return "", registerState{}, errs
 			}
+			updateReadOnlyDataPointers(&regState, statement, readOnlyData)
 			assembly += assemblyForStatement
 
 		case whileLoop:
+			if statement.label != "" {
+				for _, loop := range loops {
+					if loop.label == statement.label {
+						return "", registerState{}, []codeParsingError{{
+							msg: errors.New("This loop is inside of another loop called `" + statement.label +
+								"` at line " + fmt.Sprint(loop.loopLocation.line) + " and column " +
+								fmt.Sprint(loop.loopLocation.column) + ", so it cannot use the same name"),
+							textLocation: statement.textLocation,
+						}}
+					}
+				}
+			}
+
 			// Save jump labels
 			loopBodyJumpLabel := state.createNewJumpLabel()
 			loopConditionJumpLabel := state.createNewJumpLabel()
@@ -201,88 +638,248 @@ func (state *compilerState) compileBlockToAssembly(
 			// Add loop head
 			assembly += "\njmp " + loopConditionJumpLabel
 
-			// Add loop body
+			// Add loop body. A register might point to read-only data at the start of the body if it
+			// might at the end of the body or at a `continue` statement, so the body is compiled again
+			// until the registers that might point to read-only data at the start stop changing.
 			assembly += "\n" + loopBodyJumpLabel + ":"
-			loopBodyAssembly, errs := state.compileBlockToAssembly(
-				statement.loopBody,
-				parseRegisterStatesToInnerScope(regState),
-				siblingFunctions,
-				assemblyForControlFlowKeywords{
-					breakAssembly:    "\njmp " + loopEndJumpLabel,
-					continueAssembly: "\njmp " + loopConditionJumpLabel,
-				},
-			)
-			if len(errs) != 0 {
-				return "", errs
+			loopBodyStartRegState := parseRegisterStatesToInnerScope(regState)
+			var loopBodyAssembly string
+			var readOnlyDataAtBreaks readOnlyDataPointers
+			for {
+				readOnlyDataAtBreaks = readOnlyDataPointers{}
+				readOnlyDataAtContinues := readOnlyDataPointers{}
+				var loopBodyRegState registerState
+				var errs []codeParsingError
+				loopBodyAssembly, loopBodyRegState, errs = state.compileBlockToAssembly(
+					statement.loopBody,
+					loopBodyStartRegState,
+					siblingFunctions,
+					append(loops[:len(loops):len(loops)], assemblyForControlFlowKeywords{
+						label:                   statement.label,
+						loopLocation:            statement.textLocation,
+						breakAssembly:           "\njmp " + loopEndJumpLabel,
+						continueAssembly:        "\njmp " + loopConditionJumpLabel,
+						numberOfDeferredBlocks:  len(deferred),
+						readOnlyDataAtBreaks:    &readOnlyDataAtBreaks,
+						readOnlyDataAtContinues: &readOnlyDataAtContinues,
+					}),
+					deferred,
+				)
+				if len(errs) != 0 {
+					return "", registerState{}, errs
+				}
+				if blockFallsThrough(statement.loopBody) {
+					readOnlyDataAtContinues.addFrom(loopBodyRegState)
+				}
+				if !readOnlyDataAtContinues.addTo(&loopBodyStartRegState) {
+					break
+				}
 			}
 			assembly += loopBodyAssembly
 
+			// The loop condition is reached from before the loop, from the end of the loop body, and
+			// from `continue` statements, which all lead to the start of the loop body
+			for register, loopBodyStartRegister := range loopBodyStartRegState.registers {
+				regState.registers[register].pointsToReadOnlyDataFrom = loopBodyStartRegister.pointsToReadOnlyDataFrom
+			}
+
 			// Add loop condition
 			assembly += "\n" + loopConditionJumpLabel + ":"
 			conditionAssembly, err := state.conditionToAssembly(&regState,
 				statement.condition, loopBodyJumpLabel, "")
 			if err.msg != nil {
-				return "", []codeParsingError{err}
+				return "", registerState{}, []codeParsingError{err}
 			}
 			assembly += conditionAssembly
 
 			// Add loop end
 			assembly += "\n" + loopEndJumpLabel + ":"
+			readOnlyDataAtBreaks.addTo(&regState)
 
 		case ifElseStatement:
 			elseBlockJumpLabel := state.createNewJumpLabel()
 			ifCheck, err := state.conditionToAssembly(&regState,
 				statement.condition, "", elseBlockJumpLabel)
 			if err.msg != nil {
-				return "", []codeParsingError{err}
+				return "", registerState{}, []codeParsingError{err}
 			}
-			innerScopeRegStates := parseRegisterStatesToInnerScope(regState)
-			ifBody, errs := state.compileBlockToAssembly(statement.ifBlock,
-				innerScopeRegStates, siblingFunctions, controlFlowKeywordsAssembly)
+			reachableBranches := []ifElseBranch{}
+			ifBody, ifBlockRegState, errs := state.compileBlockToAssembly(statement.ifBlock,
+				regState, siblingFunctions, loops, deferred)
 			if len(errs) != 0 {
-				return "", errs
+				return "", registerState{}, errs
+			}
+			if blockFallsThrough(statement.ifBlock) {
+				add(&reachableBranches, ifElseBranch{
+					location: statement.textLocation,
+					regState: ifBlockRegState,
+				})
 			}
 			if len(statement.elseBlock) > 0 {
 				endJumpLabel := state.createNewJumpLabel()
-				elseBody, errs := state.compileBlockToAssembly(statement.elseBlock,
-					innerScopeRegStates, siblingFunctions, controlFlowKeywordsAssembly)
+				elseBody, elseBlockRegState, errs := state.compileBlockToAssembly(statement.elseBlock,
+					regState, siblingFunctions, loops, deferred)
 				if len(errs) != 0 {
-					return "", errs
+					return "", registerState{}, errs
+				}
+				if blockFallsThrough(statement.elseBlock) {
+					add(&reachableBranches, ifElseBranch{
+						location: statement.elseBlockLocation,
+						regState: elseBlockRegState,
+					})
 				}
 				assembly += ifCheck + ifBody + "\njmp " + endJumpLabel + "\n" +
 					elseBlockJumpLabel + ":" + elseBody + "\n" + endJumpLabel + ":"
 			} else {
+				add(&reachableBranches, ifElseBranch{
+					location:       statement.textLocation,
+					isImplicitElse: true,
+					regState:       regState,
+				})
 				assembly += ifCheck + ifBody + "\n" + elseBlockJumpLabel + ":"
 			}
+			regState, errs = mergeIfElseBranches(regState, reachableBranches)
+			if len(errs) != 0 {
+				return "", registerState{}, errs
+			}
 
 		case breakStatement:
-			if controlFlowKeywordsAssembly.breakAssembly == "" {
-				return "", []codeParsingError{{
-					msg:          errors.New("Break statement is not valid in this scope"),
-					textLocation: textLocation(statement),
-				}}
+			loop, err := findLoopForControlFlowKeyword(loops, "break", statement.label, statement.textLocation)
+			if err.msg != nil {
+				return "", registerState{}, []codeParsingError{err}
+			}
+			deferredAssembly, errs := state.compileDeferredCode(deferred[loop.numberOfDeferredBlocks:],
+				regState, siblingFunctions, exitDescription("break", statement.textLocation))
+			if len(errs) != 0 {
+				return "", registerState{}, errs
 			}
-			assembly += controlFlowKeywordsAssembly.breakAssembly
+			loop.readOnlyDataAtBreaks.addFrom(regState)
+			assembly += deferredAssembly + loop.breakAssembly
 		case continueStatement:
-			if controlFlowKeywordsAssembly.continueAssembly == "" {
-				return "", []codeParsingError{{
-					msg:          errors.New("Continue statement is not valid in this scope"),
-					textLocation: textLocation(statement),
-				}}
+			loop, err := findLoopForControlFlowKeyword(loops, "continue", statement.label, statement.textLocation)
+			if err.msg != nil {
+				return "", registerState{}, []codeParsingError{err}
+			}
+			deferredAssembly, errs := state.compileDeferredCode(deferred[loop.numberOfDeferredBlocks:],
+				regState, siblingFunctions, exitDescription("continue", statement.textLocation))
+			if len(errs) != 0 {
+				return "", registerState{}, errs
 			}
-			assembly += controlFlowKeywordsAssembly.continueAssembly
+			loop.readOnlyDataAtContinues.addFrom(regState)
+			assembly += deferredAssembly + loop.continueAssembly
 
 		case dropVariableStatement:
 			_, err := getRegisterFromVariableName(&regState, statement.variable, true, statement.textLocation)
 			if err.msg != nil {
-				return "", []codeParsingError{err}
+				return "", registerState{}, []codeParsingError{err}
 			}
 
 		default:
 			panic("Unexpected internal state")
 		}
 	}
-	return assembly, []codeParsingError{}
+
+	// Run the code that was deferred in this block if the end of the block can be reached
+	if blockFallsThrough(block) {
+		deferredAssembly, errs := state.compileDeferredCode(deferred[numberOfDeferredBlocksOutsideBlock:],
+			regState, siblingFunctions, "at the end of the block")
+		if len(errs) != 0 {
+			return "", registerState{}, errs
+		}
+		assembly += deferredAssembly
+	}
+	return assembly, regState, []codeParsingError{}
+}
+
+// Returns the location of the read-only data that `untypedValue` might point to, or textLocation{}
+// if it does not point to read-only data
+func readOnlyDataThatValuePointsTo(regState *registerState, untypedValue rawValue) textLocation {
+	switch value := untypedValue.(type) {
+	case stringValue:
+		return value.textLocation
+	case variableValue:
+		if value.pointerDereferenceLayers > 0 {
+			return textLocation{}
+		}
+		for _, register := range regState.registers {
+			if register.variableName == value.name {
+				return register.pointsToReadOnlyDataFrom
+			}
+		}
+	case arithmeticExpression:
+		if value.operator != "+" && value.operator != "-" {
+			return textLocation{}
+		}
+		if location := readOnlyDataThatValuePointsTo(regState, value.left); location.line != 0 {
+			return location
+		}
+		if value.operator == "+" {
+			return readOnlyDataThatValuePointsTo(regState, value.right)
+		}
+	}
+	return textLocation{}
+}
+
+// Returns the register of a destination that is a register or a variable, or `UnknownRegister` if
+// the destination is a variable that does not exist
+func registerOfDestination(regState *registerState, destination variableMutationDestination) Register {
+	if destination.register != UnknownRegister {
+		return destination.register
+	}
+	for register := range regState.registers {
+		if regState.registers[register].variableName == destination.name {
+			return Register(register)
+		}
+	}
+	return UnknownRegister
+}
+
+// Gives an error if any of `destinations` write to memory that a register points to, where the
+// register might point to read-only data
+func checkForWritesToReadOnlyData(regState *registerState, destinations []variableMutationDestination) codeParsingError {
+	for _, destination := range destinations {
+		register := registerOfDestination(regState, destination)
+		if destination.pointerDereferenceLayers != 1 || register == UnknownRegister {
+			continue
+		}
+		readOnlyData := regState.registers[register].pointsToReadOnlyDataFrom
+		if readOnlyData.line != 0 {
+			return codeParsingError{
+				msg: errors.New("This might write to the read-only data at line " +
+					fmt.Sprint(readOnlyData.line) + " and column " + fmt.Sprint(readOnlyData.column) +
+					", which cannot be written to"),
+				textLocation: destination.textLocation,
+			}
+		}
+	}
+	return codeParsingError{}
+}
+
+// Updates which registers might point to read-only data after `statement`. `readOnlyData` is the
+// location of the read-only data that the value of `statement` might point to.
+func updateReadOnlyDataPointers(regState *registerState, statement mutationStatement, readOnlyData textLocation) {
+	if _, isFunctionCall := statement.operation.(setToFunctionCallValue); isFunctionCall {
+		// The function might have overwritten any register that is not used by a variable
+		for register := range regState.registers {
+			if regState.registers[register].variableName == "" {
+				regState.registers[register].pointsToReadOnlyDataFrom = textLocation{}
+			}
+		}
+	}
+	for _, destination := range statement.destination {
+		register := registerOfDestination(regState, destination)
+		if destination.pointerDereferenceLayers > 0 || register == UnknownRegister {
+			continue
+		}
+		switch statement.operation.(type) {
+		case setToRawValue:
+			regState.registers[register].pointsToReadOnlyDataFrom = readOnlyData
+		case incrementBy1, decrementBy1, incrementByRawValue, decrementByRawValue:
+			// A pointer to read-only data still points to read-only data after it is moved
+		default:
+			regState.registers[register].pointsToReadOnlyDataFrom = textLocation{}
+		}
+	}
 }
 
 type registerAndLocation struct {
@@ -327,6 +924,14 @@ func (state *compilerState) compileFunctionCallArguments(
 				return "", []registerAndLocation{}, []codeParsingError{err}
 			}
 		} else {
+			if argRegister == AnyRegister {
+				return "", []registerAndLocation{}, []codeParsingError{{
+					textLocation: arg.textLocation,
+					msg: errors.New("`any` can only be used in function heads, and in the return " +
+						"statements of functions that return a value in an `any` register."),
+				}}
+			}
+
 			if regState.registers[argRegister].registerWasDefinedAsMutableAt.line == 0 {
 				return "", []registerAndLocation{}, []codeParsingError{{
 					textLocation: arg.textLocation,
@@ -346,7 +951,7 @@ func (state *compilerState) compileFunctionCallArguments(
 				return "", []registerAndLocation{}, []codeParsingError{err}
 			}
 
-			assembly += "\nmov " + argValue + ", " + commonAssemblyRegisterToX86Register(argRegister)
+			assembly += loadIntoRegister(argValue, sizeOfValue(arg.value), argRegister)
 		}
 
 		for _, register := range registers {
@@ -377,6 +982,12 @@ func validateVariableMutationDestination(mutatedValue variableMutationDestinatio
 	errs := []codeParsingError{}
 
 	// Handle the mutated register if there is one
+	if mutatedValue.register == AnyRegister {
+		return UnknownRegister, []codeParsingError{{
+			msg:          errors.New("`any` can only be used as a register in function heads and return statements."),
+			textLocation: mutatedValue.textLocation,
+		}}
+	}
 	if mutatedValue.register != UnknownRegister {
 		// Check if the register is already reserved for another variable
 		if regState.registers[mutatedValue.register].variableName != "" {
@@ -476,17 +1087,17 @@ func validateVariableMutationDestination(mutatedValue variableMutationDestinatio
 	return register, []codeParsingError{}
 }
 
-// Compiles a variableMutation ASTitem of type Assignment, PlusEquals, MinusEquals, MultiplyEquals or DivideEquals into assembly
-func (state *compilerState) compileVariableMutation(
-	instruction string,
+// Checks that `destination` is one variable, and updates the register states. Returns the register
+// that is being mutated, and the assembly for the register or the memory that is being mutated.
+func validateSingleVariableMutationDestination(
 	source rawValue,
 	destination []variableMutationDestination,
 	location textLocation,
 	regState *registerState,
-) (string, []codeParsingError) {
+) (Register, string, []codeParsingError) {
 	// Check that there is only one thing be mutated
 	if len(destination) != 1 {
-		return "", []codeParsingError{{
+		return UnknownRegister, "", []codeParsingError{{
 			textLocation: location,
 			msg: errors.New(
 				"Expect 1 value on left side of equals unless a function is being called. Got " +
@@ -500,12 +1111,12 @@ func (state *compilerState) compileVariableMutation(
 	// Get the common assembly register that is being mutated, and update the register states
 	register, errs := validateVariableMutationDestination(destination[0], regState)
 	if len(errs) != 0 {
-		return "", errs
+		return UnknownRegister, "", errs
 	}
 
 	// Check that the register is reserved for a variable
 	if destination[0].name == "" {
-		return "", []codeParsingError{{
+		return UnknownRegister, "", []codeParsingError{{
 			textLocation: destination[0].textLocation,
 			msg: errors.New("Without giving a register a variable name, the value that" +
 				" you assign to the register here cannot be used later, so there is no" +
@@ -515,72 +1126,685 @@ func (state *compilerState) compileVariableMutation(
 	}
 
 	// Convert the common assembly register number into an x86 register
-	mutatedRegisterAssembly := strings.Repeat(
-		"(", int(destination[0].pointerDereferenceLayers)) +
-		commonAssemblyRegisterToX86Register(register) +
-		strings.Repeat(")", int(destination[0].pointerDereferenceLayers))
+	mutatedRegisterAssembly, err := memoryOperandToAssembly(regState, register,
+		destination[0].pointerDereferenceLayers, destination[0].offset, destination[0].textLocation)
+	if err.msg != nil {
+		return UnknownRegister, "", []codeParsingError{err}
+	}
+	return register, mutatedRegisterAssembly, []codeParsingError{}
+}
+
+// Compiles a variableMutation ASTitem of type Assignment, PlusEquals, MinusEquals, AndEquals,
+// OrEquals, XorEquals, ShiftLeftEquals, or ShiftRightEquals into assembly. `instruction` should not
+// have a suffix, since the suffix is chosen from the size of the destination.
+func (state *compilerState) compileVariableMutation(
+	instruction string,
+	source rawValue,
+	destination []variableMutationDestination,
+	location textLocation,
+	regState *registerState,
+) (string, []codeParsingError) {
+	register, mutatedRegisterAssembly, errs := validateSingleVariableMutationDestination(
+		source, destination, location, regState)
+	if len(errs) != 0 {
+		return "", errs
+	}
+	size := sizeOfDestination(destination[0])
+	suffix := instructionSuffix(size.bits)
 
 	// Get the assembly for the source if a source is specified
 	if source == nil {
-		return "\n" + instruction + " " + mutatedRegisterAssembly, []codeParsingError{}
-	} else {
-		valueBeingAssignedToVariable, err := state.convertValueToAssembly(regState, source)
+		return "\n" + instruction + suffix + " " + mutatedRegisterAssembly, []codeParsingError{}
+	}
+	if !numberFitsInBits(source, size.bits) {
+		return "", []codeParsingError{{
+			msg:          errors.New("This value does not fit in the " + fmt.Sprint(size.bits) + " bits of memory that it is stored in"),
+			textLocation: source.location(),
+		}}
+	}
+	valueBeingAssignedToVariable, err := state.convertValueToAssembly(regState, source)
+	if err.msg != nil {
+		return "", []codeParsingError{err}
+	}
+	switch instruction {
+	case "shl", "shr", "sar":
+		valueBeingAssignedToVariable, err = shiftAmountToAssembly(source, valueBeingAssignedToVariable)
 		if err.msg != nil {
 			return "", []codeParsingError{err}
 		}
-		return "\n" + instruction + " " + valueBeingAssignedToVariable + ", " + mutatedRegisterAssembly, []codeParsingError{}
+		return "\n" + instruction + suffix + " " + valueBeingAssignedToVariable + ", " + mutatedRegisterAssembly, []codeParsingError{}
+	}
+
+	// Move the source into a register first if x86-64 cannot use it directly
+	out := ""
+	destinationIsMemory := destination[0].pointerDereferenceLayers > 0
+	legalisationReason := ""
+	if destinationIsMemory && valueIsMemory(source) {
+		legalisationReason = memoryToMemoryLegalisationReason
+	} else if !immediateFitsIn32Bits(valueBeingAssignedToVariable) &&
+		(destinationIsMemory || (instruction != "mov" && instruction != "not")) {
+		legalisationReason = largeNumberLegalisationReason
+	}
+	if legalisationReason != "" {
+		scratch := scratchRegisters{regState: regState}
+		sourceRegister, err := scratch.takeToLegalise(source.location(), legalisationReason)
+		if err.msg != nil {
+			return "", []codeParsingError{err}
+		}
+		out = loadIntoRegister(valueBeingAssignedToVariable, sizeOfValue(source), sourceRegister)
+		valueBeingAssignedToVariable = commonAssemblyRegisterToSizedX86Register(sourceRegister, size.bits)
+	} else {
+		valueBeingAssignedToVariable = resizeRegisterOperand(source, valueBeingAssignedToVariable, regState, size.bits)
+	}
+
+	switch instruction {
+	case "mov", "not":
+		if legalisationReason == "" && !destinationIsMemory {
+			// Values that are read from memory that is smaller then 64 bits have to be extended to fill
+			// the register
+			if instruction == "mov" || valueBeingAssignedToVariable != mutatedRegisterAssembly {
+				out = loadIntoRegister(valueBeingAssignedToVariable, sizeOfValue(source), register)
+			}
+		} else {
+			out += "\nmov" + suffix + " " + valueBeingAssignedToVariable + ", " + mutatedRegisterAssembly
+		}
+		// `not` only has one operand, so the source has to be moved into the destination first
+		if instruction == "not" {
+			out += "\nnot" + suffix + " " + mutatedRegisterAssembly
+		}
+		return out, []codeParsingError{}
 	}
+	return out + "\n" + instruction + suffix + " " + valueBeingAssignedToVariable + ", " + mutatedRegisterAssembly,
+		[]codeParsingError{}
 }
 
-// Compiles a functionCall ASTitem of type Assignment, PlusEquals, MinusEquals, MultiplyEquals or DivideEquals into assembly
-func (state *compilerState) compileFunctionCall(
+// If `value` is a variable that is not dereferenced, then this returns the x86-64 register that
+// contains the lowest `bits` bits of the variable. Otherwise `valueAssembly` is returned.
+func resizeRegisterOperand(value rawValue, valueAssembly string, regState *registerState, bits uint8) string {
+	variable, isVariable := value.(variableValue)
+	if !isVariable || variable.pointerDereferenceLayers > 0 || bits == 64 {
+		return valueAssembly
+	}
+	for register := range regState.registers {
+		if commonAssemblyRegisterToX86Register(Register(register)) == valueAssembly {
+			return commonAssemblyRegisterToSizedX86Register(Register(register), bits)
+		}
+	}
+	panic("Unexpected internal state")
+}
+
+// Compiles a variable mutation like `x += value`. If `value` is an arithmetic expression, `value`
+// reads memory that is smaller then 64 bits, or `instruction` is "", then the mutation is compiled
+// like `x = x + (value)` instead of using `instruction`.
+func (state *compilerState) compileVariableMutationByOperator(
+	instruction string,
+	operator string,
+	source rawValue,
 	destination []variableMutationDestination,
-	operation setToFunctionCallValue,
+	location textLocation,
 	regState *registerState,
-	siblingFunctions map[string]functionDefinition,
 ) (string, []codeParsingError) {
-	// TODO: Add support for functions having any as a register
-	assert(notEq(operation.functionName, ""))
+	_, isExpression := source.(arithmeticExpression)
+	if (instruction != "" && !isExpression && sizeOfValue(source).bits == 64) || len(destination) != 1 {
+		return state.compileVariableMutation(instruction, source, destination, location, regState)
+	}
+	return state.compileExpressionAssignment(arithmeticExpression{
+		textLocation: location,
+		operator:     operator,
+		left: variableValue{
+			textLocation:             destination[0].textLocation,
+			name:                     destination[0].name,
+			pointerDereferenceLayers: destination[0].pointerDereferenceLayers,
+			dereferenceSize:          destination[0].dereferenceSize,
+			offset:                   destination[0].offset,
+		},
+		right: source,
+	}, destination, location, regState)
+}
 
-	// Check that the function is defined, and get the code to call the function
-	functionCallCode := ""
-	_, isUserDefinedFunction := siblingFunctions[operation.functionName]
-	if isUserDefinedFunction {
-		// Compile the function if it has not been compiled already
-		errs := state.compileFunctionDefinition(siblingFunctions[operation.functionName], siblingFunctions)
-		if len(errs) != 0 {
-			return "", errs
+// Compiles an assignment where the value is an arithmetic expression into assembly
+func (state *compilerState) compileExpressionAssignment(
+	value arithmeticExpression,
+	destination []variableMutationDestination,
+	location textLocation,
+	regState *registerState,
+) (string, []codeParsingError) {
+	register, mutatedRegisterAssembly, errs := validateSingleVariableMutationDestination(
+		value, destination, location, regState)
+	if len(errs) != 0 {
+		return "", errs
+	}
+
+	// The expression can only be calculated in the destination register if the destination is not
+	// memory, and the expression does not use the destination after it is overwritten with the first
+	// value in the expression. If the first value is the destination, then the destination is only
+	// overwritten by the last instruction.
+	scratch := scratchRegisters{regState: regState}
+	scratch.inUse[register] = true
+	if destination[0].pointerDereferenceLayers == 0 && !expressionUsesRegisterAfterFirstValue(value, register, regState) {
+		scratch.overwrittenVariable = regState.registers[register].variableName
+	}
+	target := register
+	left, leftIsVariable := value.left.(variableValue)
+	leftIsDestination := leftIsVariable && left.pointerDereferenceLayers == 0 && left.field == "" &&
+		left.name == regState.registers[register].variableName
+	if destination[0].pointerDereferenceLayers > 0 ||
+		!leftIsDestination && expressionUsesRegisterAfterFirstValue(value, register, regState) {
+		var err codeParsingError
+		target, err = scratch.take(value.textLocation)
+		if err.msg != nil {
+			return "", []codeParsingError{err}
 		}
+	}
 
-		// Increase the references to the function
-		entry, ok := state.compiledFunctions[operation.functionName]
-		assert(eq(ok, true))
-		entry.references++
-		state.compiledFunctions[operation.functionName] = entry
+	// Calculate the expression
+	assembly, err := state.compileExpression(target, value, &scratch)
+	if err.msg != nil {
+		return "", []codeParsingError{err}
+	}
+	if target != register || destination[0].pointerDereferenceLayers > 0 {
+		size := sizeOfDestination(destination[0])
+		assembly += "\nmov" + instructionSuffix(size.bits) + " " +
+			commonAssemblyRegisterToSizedX86Register(target, size.bits) + ", " + mutatedRegisterAssembly
+	}
+	return assembly, []codeParsingError{}
+}
 
-		// Set functionCallCode
-		functionCallCode = "/" + operation.functionName + "/"
-	} else {
-		switch operation.functionName {
-		case "sysRead":
-			functionCallCode = "mov $0, %rax\nsyscall"
-		case "sysWrite":
-			functionCallCode = "mov $1, %rax\nsyscall"
-		case "sysOpen":
-			functionCallCode = "mov $2, %rax\nsyscall"
-		case "sysClose":
-			functionCallCode = "mov $3, %rax\nsyscall"
-		case "sysBrk":
-			functionCallCode = "mov $12, %rax\nsyscall"
-		case "sysExit":
-			functionCallCode = "mov $60, %rax\nsyscall"
+// Returns true if a variable that is stored in `register` is used in `value` other then as the
+// first value that is calculated
+func expressionUsesRegisterAfterFirstValue(
+	value rawValue,
+	register Register,
+	regState *registerState,
+) bool {
+	variableName := regState.registers[register].variableName
+	values := valuesInExpression(value)
+	for _, value := range values[1:] {
+		variable, isVariable := value.(variableValue)
+		if isVariable && (variable.name == variableName || variable.offset.index == variableName) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns every value in an arithmetic expression in the order that they are calculated
+func valuesInExpression(value rawValue) []rawValue {
+	expression, isExpression := value.(arithmeticExpression)
+	if !isExpression {
+		return []rawValue{value}
+	}
+	return append(valuesInExpression(expression.left), valuesInExpression(expression.right)...)
+}
+
+// Tracks the registers that can store the intermediate values of an arithmetic expression. A
+// register can store an intermediate value if the surrounding function mutates it, it is not used
+// by a variable, and it is not already storing another intermediate value.
+type scratchRegisters struct {
+	regState *registerState
+	inUse    [16]bool
+	// The variable that the result of the calculation is stored in, if it is not used in the
+	// calculation after the first value. Its register can store intermediate values, since its value
+	// is overwritten anyway.
+	overwrittenVariable string
+}
+
+func (scratch *scratchRegisters) isFree(register Register) bool {
+	// r14 is never used since it is the stack pointer
+	variableName := scratch.regState.registers[register].variableName
+	return register != 14 && !scratch.inUse[register] &&
+		(variableName == "" || variableName == scratch.overwrittenVariable) &&
+		scratch.regState.registers[register].registerWasDefinedAsMutableAt.line != 0
+}
+
+// The order that `take` tries registers in. r2 is needed by shifts, and r0 and r3 are needed by
+// divisions, so they are used last.
+var scratchRegisterOrder = []Register{1, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 15, 2, 3, 0}
+
+// Marks the first free register as in use, and returns it
+func (scratch *scratchRegisters) take(location textLocation) (Register, codeParsingError) {
+	for _, register := range scratchRegisterOrder {
+		if scratch.isFree(register) {
+			scratch.inUse[register] = true
+			return register, codeParsingError{}
+		}
+	}
+	return UnknownRegister, codeParsingError{
+		msg: errors.New("There are no free registers to store an intermediate value of this calculation " +
+			"in. Add a register that is not used by a variable to the list of registers that the " +
+			"function mutates."),
+		textLocation: location,
+	}
+}
+
+// Same as `take`, but does not return any of `registers`
+func (scratch *scratchRegisters) takeOtherThan(location textLocation, registers []Register) (Register, codeParsingError) {
+	wasInUse := scratch.inUse
+	for _, register := range registers {
+		scratch.inUse[register] = true
+	}
+	register, err := scratch.take(location)
+	for _, register := range registers {
+		scratch.inUse[register] = wasInUse[register]
+	}
+	return register, err
+}
+
+// The reasons that a value has to be moved into a register before x86-64 can use it
+const (
+	memoryToMemoryLegalisationReason        = "x86-64 instructions cannot use 2 values that are stored in memory"
+	largeNumberLegalisationReason           = "x86-64 instructions can only use numbers that fit in 32 bits, other then moving a number into a register"
+	numberComparisonLegalisationReason      = "x86-64 cannot compare 2 values that are not stored in a register or in memory"
+	smallMemoryComparisonLegalisationReason = "x86-64 can only compare memory that is smaller then 64 bits with a number that fits in it"
+)
+
+// Same as `take`, but for a value that has to be moved into a register before x86-64 can use it.
+// `reason` is why the value has to be moved into a register.
+func (scratch *scratchRegisters) takeToLegalise(location textLocation, reason string) (Register, codeParsingError) {
+	register, err := scratch.take(location)
+	if err.msg != nil {
+		err.msg = errors.New(reason + ", so this value has to be moved into a register first, but there " +
+			"are no free registers. Add a register that is not used by a variable to the list of " +
+			"registers that the function mutates.")
+	}
+	return register, err
+}
+
+// Marks `register` as in use for an operator that can only use that register
+func (scratch *scratchRegisters) reserve(
+	register Register,
+	operator arithmeticExpression,
+) codeParsingError {
+	if !scratch.isFree(register) {
+		problem := "Add r" + fmt.Sprint(register) + " to the list of registers that the function mutates."
+		if scratch.inUse[register] {
+			problem = "It is already used by another part of this calculation, so split the calculation " +
+				"into several lines."
+		} else if variable := scratch.regState.registers[register].variableName; variable != "" {
+			problem = "Drop the `" + variable + "` variable that uses it before this calculation."
+		}
+		return codeParsingError{
+			msg: errors.New("On x86-64, `" + operator.operator + "` needs to use the r" + fmt.Sprint(register) +
+				" register, but r" + fmt.Sprint(register) + " is not free. " + problem),
+			textLocation: operator.textLocation,
+		}
+	}
+	scratch.inUse[register] = true
+	return codeParsingError{}
+}
+
+// The instructions that calculate the operators that only need one instruction, and do not need
+// specific registers
+var arithmeticOperatorInstructions = map[string]string{
+	"+":   "add",
+	"-":   "sub",
+	"&":   "and",
+	"|":   "or",
+	"xor": "xor",
+	"*":   "imul",
+}
+
+// Compiles the assembly that calculates `value` and stores the result in `target`
+func (state *compilerState) compileExpression(
+	target Register,
+	value rawValue,
+	scratch *scratchRegisters,
+) (string, codeParsingError) {
+	targetAssembly := commonAssemblyRegisterToX86Register(target)
+
+	// Handle values that are not calculated
+	expression, isExpression := value.(arithmeticExpression)
+	if !isExpression {
+		valueAssembly, err := state.convertValueToAssembly(scratch.regState, value)
+		if err.msg != nil || valueAssembly == targetAssembly {
+			return "", err
+		}
+		return loadIntoRegister(valueAssembly, sizeOfValue(value), target), codeParsingError{}
+	}
+
+	// Calculate the left value in the target
+	assembly, err := state.compileExpression(target, expression.left, scratch)
+	if err.msg != nil {
+		return "", err
+	}
+
+	// If calculating the right value needs the register that stores the left value, then the left
+	// value is moved into a free register until the operator has been calculated
+	if neededRegisters := registersNeededToCalculate(expression.right); slices.Contains(neededRegisters, target) {
+		movedTarget, err := scratch.takeOtherThan(expression.textLocation, neededRegisters)
+		if err.msg == nil {
+			scratch.inUse[target] = false
+			operatorAssembly, err := state.compileOperator(movedTarget, expression, scratch)
+			scratch.inUse[target] = true
+			scratch.inUse[movedTarget] = false
+			return assembly + "\nmovq " + targetAssembly + ", " + commonAssemblyRegisterToX86Register(movedTarget) +
+				operatorAssembly + "\nmovq " + commonAssemblyRegisterToX86Register(movedTarget) + ", " +
+				targetAssembly, err
+		}
+	}
+	operatorAssembly, err := state.compileOperator(target, expression, scratch)
+	return assembly + operatorAssembly, err
+}
+
+// Returns the registers that have to be used to calculate `value` on x86-64, which are r0 and r3
+// for a division, and r2 for a shift by a number of bits that is not known at compile time
+func registersNeededToCalculate(value rawValue) []Register {
+	expression, isExpression := value.(arithmeticExpression)
+	if !isExpression {
+		return []Register{}
+	}
+	registers := append(registersNeededToCalculate(expression.left), registersNeededToCalculate(expression.right)...)
+	switch expression.operator {
+	case "/", "%":
+		registers = append(registers, 0, 3)
+	case "<<", ">>", ">>>":
+		if _, isNumber := expression.right.(numberValue[uint64]); !isNumber {
+			registers = append(registers, 2)
+		}
+	}
+	return registers
+}
+
+// Compiles the assembly that calculates the right value of `expression`, and then applies the
+// operator of `expression` to `target`, which stores the left value
+func (state *compilerState) compileOperator(
+	target Register,
+	expression arithmeticExpression,
+	scratch *scratchRegisters,
+) (string, codeParsingError) {
+	targetAssembly := commonAssemblyRegisterToX86Register(target)
+	switch expression.operator {
+	case "/", "%":
+		return state.compileDivision(target, expression, scratch)
+	case "<<", ">>", ">>>":
+		return state.compileShift(target, expression, scratch)
+	}
+	instruction, isKnownOperator := arithmeticOperatorInstructions[expression.operator]
+	assert(eq(isKnownOperator, true))
+	rightAssembly, rightOperand, rightRegister, err := state.compileExpressionOperand(
+		expression.right, scratch)
+	if err.msg != nil {
+		return "", err
+	}
+	if rightRegister != UnknownRegister {
+		scratch.inUse[rightRegister] = false
+	}
+	return rightAssembly + "\n" + instruction + "q " + rightOperand + ", " + targetAssembly,
+		codeParsingError{}
+}
+
+// Gets an operand for `value`. If `value` is an arithmetic expression, or reads memory that is
+// smaller then 64 bits, then it is calculated in a free register, and that register is returned so
+// that the caller can mark it as no longer in use. Otherwise `UnknownRegister` is returned. The returned strings are the assembly to calculate the
+// operand, and the operand itself.
+func (state *compilerState) compileExpressionOperand(
+	value rawValue,
+	scratch *scratchRegisters,
+) (string, string, Register, codeParsingError) {
+	_, isExpression := value.(arithmeticExpression)
+	if !isExpression && sizeOfValue(value).bits == 64 {
+		valueAssembly, err := state.convertValueToAssembly(scratch.regState, value)
+		if err.msg != nil || immediateFitsIn32Bits(valueAssembly) {
+			return "", valueAssembly, UnknownRegister, err
+		}
+		register, err := scratch.takeToLegalise(value.location(), largeNumberLegalisationReason)
+		if err.msg != nil {
+			return "", "", UnknownRegister, err
+		}
+		return loadIntoRegister(valueAssembly, sizeOfValue(value), register),
+			commonAssemblyRegisterToX86Register(register), register, codeParsingError{}
+	}
+	register, err := scratch.take(value.location())
+	if err.msg != nil {
+		return "", "", UnknownRegister, err
+	}
+	assembly, err := state.compileExpression(register, value, scratch)
+	return assembly, commonAssemblyRegisterToX86Register(register), register, err
+}
+
+// Compiles a division or a remainder. On x86-64, the number being divided has to be stored in r0
+// and r3, the quotient is stored in r0, and the remainder is stored in r3.
+func (state *compilerState) compileDivision(
+	target Register,
+	expression arithmeticExpression,
+	scratch *scratchRegisters,
+) (string, codeParsingError) {
+	for _, register := range []Register{0, 3} {
+		if register == target {
+			continue
+		}
+		err := scratch.reserve(register, expression)
+		if err.msg != nil {
+			return "", err
+		}
+		defer func() { scratch.inUse[register] = false }()
+	}
+
+	// Get the divisor, which cannot be a number, or use r0 or r3
+	assembly, divisor, divisorRegister, err := state.compileExpressionOperand(expression.right, scratch)
+	if err.msg != nil {
+		return "", err
+	}
+	if target != 0 && target != 3 && strings.HasPrefix(divisor, "$") {
+		// The number being divided is moved into r0, so the target can store the divisor
+		assembly += "\nmovq " + commonAssemblyRegisterToX86Register(target) + ", " +
+			commonAssemblyRegisterToX86Register(0) +
+			loadIntoRegister(divisor, memoryAccessSize{bits: 64}, target)
+		return assembly + divisionToAssembly(target, commonAssemblyRegisterToX86Register(target), expression.operator), codeParsingError{}
+	}
+	if strings.HasPrefix(divisor, "$") || strings.Contains(divisor, commonAssemblyRegisterToX86Register(0)) ||
+		strings.Contains(divisor, commonAssemblyRegisterToX86Register(3)) {
+		assert(eq(divisorRegister, UnknownRegister))
+		divisorRegister, err = scratch.take(expression.textLocation)
+		if err.msg != nil {
+			return "", err
+		}
+		assembly += loadIntoRegister(divisor, memoryAccessSize{bits: 64}, divisorRegister)
+		divisor = commonAssemblyRegisterToX86Register(divisorRegister)
+	}
+	if divisorRegister != UnknownRegister {
+		scratch.inUse[divisorRegister] = false
+	}
+
+	// Divide
+	if target != 0 {
+		assembly += "\nmovq " + commonAssemblyRegisterToX86Register(target) + ", " +
+			commonAssemblyRegisterToX86Register(0)
+	}
+	return assembly + divisionToAssembly(target, divisor, expression.operator), codeParsingError{}
+}
+
+// Divides r0 and r3 by `divisor`, and moves the quotient or remainder into `target`
+func divisionToAssembly(target Register, divisor string, operator string) string {
+	assembly := "\ncqo\nidivq " + divisor
+	result := Register(0)
+	if operator == "%" {
+		result = 3
+	}
+	if result != target {
+		assembly += "\nmovq " + commonAssemblyRegisterToX86Register(result) + ", " +
+			commonAssemblyRegisterToX86Register(target)
+	}
+	return assembly
+}
+
+// Compiles a shift. On x86-64, the number of bits to shift by must either be a number from 0 to 63,
+// or be stored in the lowest byte of r2.
+func (state *compilerState) compileShift(
+	target Register,
+	expression arithmeticExpression,
+	scratch *scratchRegisters,
+) (string, codeParsingError) {
+	instruction := map[string]string{"<<": "shlq", ">>": "sarq", ">>>": "shrq"}[expression.operator]
+	targetAssembly := commonAssemblyRegisterToX86Register(target)
+
+	// Handle shifting by a number
+	if _, isExpression := expression.right.(arithmeticExpression); !isExpression {
+		amountAssembly, err := state.convertValueToAssembly(scratch.regState, expression.right)
+		if err.msg != nil {
+			return "", err
+		}
+		if _, isVariable := expression.right.(variableValue); !isVariable {
+			amountAssembly, err = shiftAmountToAssembly(expression.right, amountAssembly)
+			return "\n" + instruction + " " + amountAssembly + ", " + targetAssembly, err
+		}
+		if amountAssembly == commonAssemblyRegisterToX86Register(2) && target != 2 {
+			return "\n" + instruction + " %cl, " + targetAssembly, codeParsingError{}
+		}
+	}
+
+	// Handle shifting by a value that has to be moved into r2
+	if target == 2 {
+		return "", codeParsingError{
+			msg:          errors.New("r2 cannot be shifted by a variable number of bits, since the number of bits to shift by has to be stored in r2"),
+			textLocation: expression.textLocation,
+		}
+	}
+	err := scratch.reserve(2, expression)
+	if err.msg != nil {
+		return "", err
+	}
+	assembly, err := state.compileExpression(2, expression.right, scratch)
+	scratch.inUse[2] = false
+	return assembly + "\n" + instruction + " %cl, " + targetAssembly, err
+}
+
+// x86-64 can only shift a register by a number of bits that is either known at compile time, or
+// stored in the lowest byte of r2. This function checks that `source` is one of those, and returns
+// the assembly to use for the number of bits to shift by.
+func shiftAmountToAssembly(source rawValue, sourceAssembly string) (string, codeParsingError) {
+	switch value := source.(type) {
+	case numberValue[uint64]:
+		if value.value < 64 {
+			return sourceAssembly, codeParsingError{}
+		}
+	case variableValue:
+		if sourceAssembly == commonAssemblyRegisterToX86Register(2) {
+			return "%cl", codeParsingError{}
+		}
+		return "", codeParsingError{
+			msg:          errors.New("A variable that is used as the number of bits to shift by must be stored in r2"),
+			textLocation: value.textLocation,
+		}
+	}
+	return "", codeParsingError{
+		msg:          errors.New("The number of bits to shift by must either be a number from 0 to 63, or a variable that is stored in r2"),
+		textLocation: source.location(),
+	}
+}
+
+// Returns true if any of the arguments or mutated registers of `function` are `any`
+func functionHasAnyRegisters(function functionDefinition) bool {
+	for _, register := range append(function.arguments, function.mutatedRegisters...) {
+		if register.register == AnyRegister {
+			return true
+		}
+	}
+	return false
+}
+
+// Replaces the `any` registers in the return statements of `block` with the registers that the
+// surrounding function returns values in. `originalReturnRegisters` are the registers that the
+// surrounding function returns values in before its `any` registers were chosen, and
+// `returnRegisters` are the registers after they were chosen.
+func replaceAnyRegistersInReturnStatements(
+	block []statement,
+	originalReturnRegisters []Register,
+	returnRegisters []Register,
+) []statement {
+	out := make([]statement, len(block))
+	for i, genericStatement := range block {
+		switch statement := genericStatement.(type) {
+		case returnStatement:
+			returnedValues := make([]registerAndRawValueAndLocation, len(statement.returnedValues))
+			copy(returnedValues, statement.returnedValues)
+			for j := range returnedValues {
+				if returnedValues[j].register == AnyRegister && j < len(originalReturnRegisters) &&
+					originalReturnRegisters[j] == AnyRegister {
+					returnedValues[j].register = returnRegisters[j]
+				}
+			}
+			statement.returnedValues = returnedValues
+			out[i] = statement
+		case ifElseStatement:
+			statement.ifBlock = replaceAnyRegistersInReturnStatements(
+				statement.ifBlock, originalReturnRegisters, returnRegisters)
+			statement.elseBlock = replaceAnyRegistersInReturnStatements(
+				statement.elseBlock, originalReturnRegisters, returnRegisters)
+			out[i] = statement
+		case whileLoop:
+			statement.loopBody = replaceAnyRegistersInReturnStatements(
+				statement.loopBody, originalReturnRegisters, returnRegisters)
+			out[i] = statement
 		default:
-			return "", []codeParsingError{{
-				textLocation: operation.textLocation,
-				msg:          errors.New("Call to undefined function `" + operation.functionName + "`"),
-			}}
+			out[i] = statement
+		}
+	}
+	return out
+}
+
+// Creates a copy of `function` where every `any` register is replaced with the register that a
+// caller chose for it. Each set of chosen registers gets its own function name, so that the copy
+// is only compiled once for every set of registers that it is called with.
+func specialiseFunctionDefinition(
+	function functionDefinition,
+	argumentRegisters []registerAndLocation,
+	mutatedRegisters []variableMutationDestination,
+) functionDefinition {
+	assert(eq(len(argumentRegisters), len(function.arguments)))
+	assert(eq(len(mutatedRegisters), len(function.mutatedRegisters)))
+	chosenRegisters := []string{}
+	chooseRegister := func(register registerAndNameAndLocation, chosenRegister Register) registerAndNameAndLocation {
+		if register.register == AnyRegister {
+			register.register = chosenRegister
+			add(&chosenRegisters, "r"+fmt.Sprint(chosenRegister))
+		}
+		return register
+	}
+
+	originalReturnRegisters := []Register{}
+	returnRegisters := []Register{}
+	mutated := make([]registerAndNameAndLocation, len(function.mutatedRegisters))
+	for i, register := range function.mutatedRegisters {
+		mutated[i] = chooseRegister(register, mutatedRegisters[i].register)
+		if register.name != "" {
+			add(&originalReturnRegisters, register.register)
+			add(&returnRegisters, mutated[i].register)
 		}
 	}
+	arguments := make([]registerAndNameAndLocation, len(function.arguments))
+	for i, register := range function.arguments {
+		arguments[i] = chooseRegister(register, argumentRegisters[i].register)
+	}
+
+	return functionDefinition{
+		textLocation:     function.textLocation,
+		name:             function.name + "[" + strings.Join(chosenRegisters, ",") + "]",
+		arguments:        arguments,
+		mutatedRegisters: mutated,
+		body: replaceAnyRegistersInReturnStatements(
+			function.body, originalReturnRegisters, returnRegisters),
+	}
+}
+
+// Compiles a functionCall ASTitem of type Assignment, PlusEquals, MinusEquals, MultiplyEquals or DivideEquals into assembly
+func (state *compilerState) compileFunctionCall(
+	destination []variableMutationDestination,
+	operation setToFunctionCallValue,
+	regState *registerState,
+	siblingFunctions map[string]functionDefinition,
+) (string, []codeParsingError) {
+	assert(notEq(operation.functionName, ""))
+
+	// Check that the function is defined
+	function, isUserDefinedFunction := siblingFunctions[operation.functionName]
+	builtin, isBuiltin := findBuiltinFunction(operation.functionName)
+	if !isUserDefinedFunction && !isBuiltin {
+		return "", []codeParsingError{{
+			textLocation: operation.textLocation,
+			msg:          errors.New("Call to undefined function `" + operation.functionName + "`"),
+		}}
+	}
 
 	// Compile the function arguments
 	assemblyForArgs, functionCallArgRegisters, errs := state.compileFunctionCallArguments(operation.functionArgs, regState, true)
@@ -592,20 +1816,25 @@ func (state *compilerState) compileFunctionCall(
 	functionExpectedArgRegisters := []Register{}
 	if isUserDefinedFunction {
 		functionExpectedArgRegisters = mapList(
-			siblingFunctions[operation.functionName].arguments,
+			function.arguments,
 			func(r registerAndNameAndLocation) Register {
 				assert(notEq(r.register, UnknownRegister))
 				return r.register
 			},
 		)
 	} else {
-		switch operation.functionName {
-		case "sysRead", "sysWrite", "sysOpen":
-			functionExpectedArgRegisters = []Register{5, 4, 3}
-		case "sysClose", "sysBrk", "sysExit":
-			functionExpectedArgRegisters = []Register{5}
-		default:
-			panic("Unexpected internal state: isUserDefinedFunction is false, and functionName is `" + operation.functionName + "`.")
+		// Optional arguments are only expected if they are given
+		requiredArguments := len(builtin.arguments) - builtin.optionalArguments
+		if len(functionCallArgRegisters) < requiredArguments {
+			missingArgument := builtin.arguments[len(functionCallArgRegisters)]
+			return "", []codeParsingError{{
+				textLocation: operation.textLocation,
+				msg: errors.New("`" + builtin.name + "` has to be given `" + missingArgument.name +
+					"` in r" + fmt.Sprint(missingArgument.register)),
+			}}
+		}
+		for _, argument := range builtin.arguments[:min(len(functionCallArgRegisters), len(builtin.arguments))] {
+			add(&functionExpectedArgRegisters, argument.register)
 		}
 	}
 
@@ -635,144 +1864,1095 @@ func (state *compilerState) compileFunctionCall(
 	// Get the expected mutated registers
 	functionExpectedMutatedRegisters := []registerAndNameAndLocation{}
 	if isUserDefinedFunction {
-		functionExpectedMutatedRegisters = siblingFunctions[operation.functionName].mutatedRegisters
+		functionExpectedMutatedRegisters = function.mutatedRegisters
 	} else {
-		switch operation.functionName {
-		case "sysRead", "sysWrite", "sysClose", "sysBrk", "sysExit":
-			functionExpectedMutatedRegisters = []registerAndNameAndLocation{{
-				register: 0,
-				name:     "exitCode",
+		functionExpectedMutatedRegisters = mapList(builtin.returnValues, func(value builtinValue) registerAndNameAndLocation {
+			return registerAndNameAndLocation{register: value.register, name: value.name}
+		})
+
+		// Clobbered registers cannot store variables, and the surrounding function has to mutate them
+		for _, register := range builtin.clobberedRegisters {
+			if regState.registers[register].variableName != "" {
+				return "", []codeParsingError{{
+					textLocation: operation.textLocation,
+					msg: errors.New("`" + operation.functionName + "` overwrites the r" + fmt.Sprint(register) +
+						" register, which stores the variable `" + regState.registers[register].variableName +
+						"`. Either drop the variable before this line of code, or store it in a different register."),
+				}}
+			}
+			if regState.registers[register].registerWasDefinedAsMutableAt.line == 0 {
+				return "", []codeParsingError{{
+					textLocation: operation.textLocation,
+					msg: errors.New("`" + operation.functionName + "` overwrites the r" + fmt.Sprint(register) +
+						" register, so the r" + fmt.Sprint(register) + " register has to be added to the list " +
+						"of registers that the function mutates."),
+				}}
+			}
+		}
+	}
+
+	// Check that the function mutated regisers use the expected registers
+	err = checkRegisterListsAreTheSame(
+		mapList(functionExpectedMutatedRegisters, func(in registerAndNameAndLocation) Register {
+			return in.register
+		}),
+		mapList(destination, func(in variableMutationDestination) registerAndLocation {
+			return registerAndLocation{
+				register: in.register,
+				location: in.textLocation,
+			}
+		}),
+	)
+	if err.msg != nil {
+		return "", []codeParsingError{err}
+	}
+	for i, expectedMutatedRegister := range functionExpectedMutatedRegisters {
+		if expectedMutatedRegister.name == "" && destination[i].name != "" {
+			return "", []codeParsingError{{
+				textLocation: destination[i].textLocation,
+				msg: errors.New("Function call stores the final value that the r" +
+					fmt.Sprint(destination[i].register) + " register was mutated to in a new " +
+					"variable called `" + destination[i].name + "`, but the function " +
+					"definition does not guarantee that it will muatate that register."),
 			}}
-		case "sysOpen":
-			functionExpectedMutatedRegisters = []registerAndNameAndLocation{{
-				register: 0,
-				name:     "fileDescriptor",
+		}
+	}
+
+	// Get the code to call the function
+	functionCallCode := ""
+	if isUserDefinedFunction {
+		// Use a copy of the function with the registers that were chosen for its `any` registers
+		if functionHasAnyRegisters(function) {
+			function = specialiseFunctionDefinition(function, functionCallArgRegisters, destination)
+		}
+
+		// Compile the function if it has not been compiled already
+		if _, alreadyCompiled := state.compiledFunctions[function.name]; !alreadyCompiled {
+			errs := state.compileFunctionDefinition(function, siblingFunctions)
+			if len(errs) != 0 {
+				return "", errs
+			}
+		}
+
+		// Increase the references to the function
+		entry, ok := state.compiledFunctions[function.name]
+		assert(eq(ok, true))
+		entry.references++
+		state.compiledFunctions[function.name] = entry
+
+		functionCallCode = "/" + function.name + "/"
+	} else {
+		instructions, availableOnTarget := builtin.instructions[compilationTarget]
+		if !availableOnTarget {
+			return "", []codeParsingError{{
+				textLocation: operation.textLocation,
+				msg:          errors.New("`" + builtin.name + "` is not available on the platform that the code is compiled for"),
 			}}
-		default:
-			panic("Unexpected internal state: isUserDefinedFunction is false, and functionName is `" + operation.functionName + "`.")
 		}
+		functionCallCode = instructions
+	}
+
+	// Return
+	return assemblyForArgs + "\n" + functionCallCode, []codeParsingError{}
+}
+
+func parseFunctionDefinitionRegisters(
+	mutatedRegisters []registerAndNameAndLocation,
+	functionArgs []registerAndNameAndLocation,
+) (registerState, []codeParsingError) {
+	out := registerState{}
+
+	// Parse the function mutated registers
+	for _, register := range mutatedRegisters {
+		// TODO: Check that the mutated registers do not have the same name
+		assert(notEq(register.register, -1))
+		assert(notEq(register.register, AnyRegister))
+		if register.name != "" {
+			add(&out.functionReturnValueRegisters, register.register)
+		}
+		if out.registers[register.register].registerWasDefinedAsMutableAt.line != 0 {
+			errMsg := errors.New("Register " + register.name + " used twice in mutated registers")
+			return registerState{}, []codeParsingError{
+				{msg: errMsg, textLocation: out.registers[register.register].registerWasDefinedAsMutableAt},
+				{msg: errMsg, textLocation: register.textLocation},
+			}
+		}
+		out.registers[register.register].registerWasDefinedAsMutableAt = register.textLocation
+	}
+
+	// Parse the function args
+	for _, arg := range functionArgs {
+		assert(notEq(arg.register, -1))
+		assert(notEq(arg.register, AnyRegister))
+		assert(notEq(arg.name, ""))
+
+		// Check that the same register has not been used already
+		if out.registers[arg.register].variableName != "" {
+			errMsg := errors.New("Register " + arg.name + " used twice in function arguments. Each register can only be used once.")
+			return registerState{}, []codeParsingError{
+				{msg: errMsg, textLocation: out.registers[arg.register].variableNameWasDefinedAt},
+				{msg: errMsg, textLocation: arg.textLocation},
+			}
+		}
+
+		// Check that the same name has not been used already
+		for _, regState := range out.registers {
+			if regState.variableName == arg.name {
+				errMsg := errors.New("Variable name " + arg.name + " used twice in function arguments. Each variable name can only be used once.")
+				return registerState{}, []codeParsingError{
+					{msg: errMsg, textLocation: out.registers[arg.register].variableNameWasDefinedAt},
+					{msg: errMsg, textLocation: arg.textLocation},
+				}
+			}
+		}
+
+		// Update registerStates
+		out.registers[arg.register].variableName = arg.name
+		out.registers[arg.register].variableNameWasDefinedAt = arg.textLocation
+	}
+
+	// Return
+	return out, []codeParsingError{}
+}
+
+func (state *compilerState) compileFunctionDefinition(
+	function functionDefinition,
+	siblingFunctions map[string]functionDefinition,
+) []codeParsingError {
+	assert(notEq(function.name, ""))
+
+	// Add the `functionName` key to the compiledFunctions hashmap so that when
+	// `compileBlockToAssembly()` calls `compileFunctionCall`, that does not call
+	// this function if the function being called is the current function being
+	// compiled to stop an infinite loop.
+	state.compiledFunctions[function.name] = compiledFunction{}
+	add(&state.compiledFunctionNames, function.name)
+
+	// Parse registers that the function mutates
+	regState, errs := parseFunctionDefinitionRegisters(function.mutatedRegisters, function.arguments)
+	if len(errs) != 0 {
+		return errs
+	}
+
+	// Compile the function
+	assembly, _, errs := state.compileBlockToAssembly(function.body, regState, siblingFunctions, nil, nil)
+	if len(errs) != 0 {
+		return errs
+	}
+
+	// Check that the function handles every failure of the built-in functions that it calls
+	errs = uncheckedResultErrors(function)
+	if len(errs) != 0 {
+		return errs
+	}
+	assert(notEq(assembly, ""))
+	if assembly[len(assembly)-1] != '\\' {
+		// If the compiled assembly does not return at the end, then add a return
+		assembly += "\n\\"
+	}
+	// Keep the references from any recursive calls to this function
+	entry := state.compiledFunctions[function.name]
+	entry.assembly = assembly
+	state.compiledFunctions[function.name] = entry
+
+	// Return
+	return []codeParsingError{}
+}
+
+// Tracks the errors that `uncheckedResultErrors` finds
+type resultChecker struct {
+	errs []codeParsingError
+	// The calls that have already been reported, so that a call that is not handled in several
+	// branches is only reported once
+	reportedCalls map[textLocation]bool
+}
+
+// The calls to built-in functions that can fail whose results have not been handled yet, by the name
+// of the variable that stores each result
+type uncheckedResults map[string]setToFunctionCallValue
+
+// Returns an error at every call in `function` to a built-in function that can fail, whose result
+// is not handled. A result is handled if it is stored in a variable that is used in the condition
+// of an if statement or while loop, or returned by the function, before the variable is mutated
+// again or dropped. It is also handled if `ignore` is written before the name of the function.
+func uncheckedResultErrors(function functionDefinition) []codeParsingError {
+	checker := resultChecker{reportedCalls: map[textLocation]bool{}}
+	unchecked := checker.checkBlock(function.body, uncheckedResults{})
+
+	// The values that are in the registers that the function returns when the end of the function is
+	// reached are returned
+	for _, register := range function.mutatedRegisters {
+		delete(unchecked, register.name)
+	}
+	checker.report(unchecked)
+
+	slices.SortFunc(checker.errs, func(a codeParsingError, b codeParsingError) int {
+		return cmp.Or(cmp.Compare(a.line, b.line), cmp.Compare(a.column, b.column))
+	})
+	return checker.errs
+}
+
+func (checker *resultChecker) report(unchecked uncheckedResults) {
+	for _, call := range unchecked {
+		if checker.reportedCalls[call.textLocation] {
+			continue
+		}
+		checker.reportedCalls[call.textLocation] = true
+		add(&checker.errs, codeParsingError{
+			textLocation: call.textLocation,
+			msg: errors.New("The result of `" + call.functionName + "` is never checked, even " +
+				"though it is negative if `" + call.functionName + "` fails. Either store it in a " +
+				"variable that is checked in a condition, or write `ignore` before `" +
+				call.functionName + "`."),
+		})
+	}
+}
+
+// Returns the results that are not handled when the end of `block` is reached. `unchecked` is not
+// modified.
+func (checker *resultChecker) checkBlock(block []statement, unchecked uncheckedResults) uncheckedResults {
+	unchecked = maps.Clone(unchecked)
+	for _, untypedStatement := range block {
+		switch statement := untypedStatement.(type) {
+		case mutationStatement:
+			// Mutating a variable that stores an unchecked result loses the result
+			for _, destination := range statement.destination {
+				if call, isUnchecked := unchecked[destination.name]; isUnchecked && destination.pointerDereferenceLayers == 0 {
+					checker.report(uncheckedResults{destination.name: call})
+					delete(unchecked, destination.name)
+				}
+			}
+
+			call, isFunctionCall := statement.operation.(setToFunctionCallValue)
+			if !isFunctionCall {
+				continue
+			}
+			builtin, isBuiltin := findBuiltinFunction(call.functionName)
+			if call.resultIsIgnored && (!isBuiltin || !builtin.canFail) {
+				add(&checker.errs, codeParsingError{
+					textLocation: call.textLocation,
+					msg:          errors.New("`ignore` is used before `" + call.functionName + "`, which cannot fail"),
+				})
+			}
+			if !isBuiltin || !builtin.canFail || call.resultIsIgnored {
+				continue
+			}
+			if len(statement.destination) == 0 || statement.destination[0].name == "" {
+				checker.report(uncheckedResults{"": call})
+				continue
+			}
+			unchecked[statement.destination[0].name] = call
+
+		case dropVariableStatement:
+			if call, isUnchecked := unchecked[statement.variable]; isUnchecked {
+				checker.report(uncheckedResults{statement.variable: call})
+				delete(unchecked, statement.variable)
+			}
+
+		case ifElseStatement:
+			markVariablesInConditionAsChecked(statement.condition, unchecked)
+			ifBlock := checker.checkBlock(statement.ifBlock, unchecked)
+			elseBlock := checker.checkBlock(statement.elseBlock, unchecked)
+			unchecked = ifBlock
+			maps.Copy(unchecked, elseBlock)
+
+		case whileLoop:
+			// The loop body might not run, so the results that are unchecked before the loop might
+			// still be unchecked after it
+			markVariablesInConditionAsChecked(statement.condition, unchecked)
+			loopBody := checker.checkBlock(statement.loopBody, unchecked)
+			// The condition is checked again at the end of the loop body before the loop is left
+			markVariablesInConditionAsChecked(statement.condition, loopBody)
+			maps.Copy(unchecked, loopBody)
+
+		case deferStatement:
+			// Deferred code runs at the end of the scope, so it has to handle its own results
+			checker.report(checker.checkBlock(statement.block, uncheckedResults{}))
+
+		case returnStatement:
+			for _, returnedValue := range statement.returnedValues {
+				if variable, isVariable := returnedValue.value.(variableValue); isVariable {
+					delete(unchecked, variable.name)
+				}
+			}
+			checker.report(unchecked)
+			return uncheckedResults{}
+		}
+	}
+	return unchecked
+}
+
+// Removes every variable that is used in `untypedCondition` from `unchecked`
+func markVariablesInConditionAsChecked(untypedCondition condition, unchecked uncheckedResults) {
+	switch condition := untypedCondition.(type) {
+	case comparison:
+		for _, value := range append(valuesInExpression(condition.leftValue), valuesInExpression(condition.rightValue)...) {
+			if variable, isVariable := value.(variableValue); isVariable {
+				delete(unchecked, variable.name)
+			}
+		}
+	case boolean:
+		for _, condition := range condition.conditions {
+			markVariablesInConditionAsChecked(condition, unchecked)
+		}
+	case notCondition:
+		markVariablesInConditionAsChecked(condition.condition, unchecked)
+	}
+}
+
+// The names that the values in a function can use other then variables
+type namesInScope struct {
+	constants map[string]rawValue
+	structs   map[string]structLayout
+	enums     map[string]enumDefinition
+	// The struct that each variable in the function being compiled points to, if the variable was
+	// given a struct where it was defined
+	variableStructs map[string]string
+	// The enum that each variable in the function being compiled stores, if the variable was given
+	// an enum where it was defined
+	variableEnums map[string]string
+}
+
+// Where the fields of a struct are stored in memory
+type structLayout struct {
+	fields map[string]structField
+	// The number of bytes in the struct, including any padding after the last field so that the
+	// struct can be stored in a list
+	size int64
+	// The biggest alignment of any of the fields
+	alignment int64
+}
+
+type structField struct {
+	// The number of bytes between the start of the struct and the field
+	offset int64
+	size   memoryAccessSize
+}
+
+// Calculates where the fields of `definition` are stored. Each field is aligned to its size.
+func calculateStructLayout(definition structDefinition) (structLayout, codeParsingError) {
+	layout := structLayout{fields: make(map[string]structField), alignment: 1}
+	for _, field := range definition.fields {
+		if _, exists := layout.fields[field.name]; exists {
+			return structLayout{}, codeParsingError{
+				msg:          errors.New("The struct `" + definition.name + "` already has a field called `" + field.name + "`"),
+				textLocation: field.textLocation,
+			}
+		}
+		bytes := int64(field.size.bits / 8)
+		layout.size = (layout.size + bytes - 1) / bytes * bytes
+		layout.fields[field.name] = structField{offset: layout.size, size: field.size}
+		layout.size += bytes
+		layout.alignment = max(layout.alignment, bytes)
+	}
+	layout.size = (layout.size + layout.alignment - 1) / layout.alignment * layout.alignment
+	return layout, codeParsingError{}
+}
+
+// Gets the field called `field` of the struct that `variable` points to
+func findStructField(
+	names *namesInScope,
+	variable string,
+	field string,
+	location textLocation,
+) (structField, codeParsingError) {
+	structName, hasStruct := names.variableStructs[variable]
+	if !hasStruct {
+		return structField{}, codeParsingError{
+			msg: errors.New("`" + variable + "` was not given a struct where it was defined, so " +
+				"`." + field + "` cannot be used. A struct is given like `r1 " + variable + ": MyStruct = ...`."),
+			textLocation: location,
+		}
+	}
+	layout, isStruct := names.structs[structName]
+	if !isStruct {
+		return structField{}, codeParsingError{
+			msg:          errors.New("Could not find a struct called `" + structName + "`"),
+			textLocation: location,
+		}
+	}
+	fieldLayout, isField := layout.fields[field]
+	if !isField {
+		return structField{}, codeParsingError{
+			msg:          errors.New("The struct `" + structName + "` does not have a field called `" + field + "`"),
+			textLocation: location,
+		}
+	}
+	return fieldLayout, codeParsingError{}
+}
+
+// Records the struct that a variable points to or the enum that it stores if it is given where the
+// variable is defined, like `r1 point: Point`
+func addVariableType(names *namesInScope, variable string, typeName string, location textLocation) codeParsingError {
+	if _, isStruct := names.structs[typeName]; isStruct {
+		names.variableStructs[variable] = typeName
+		return codeParsingError{}
+	}
+	if _, isEnum := names.enums[typeName]; isEnum {
+		names.variableEnums[variable] = typeName
+		return codeParsingError{}
+	}
+	return codeParsingError{
+		msg:          errors.New("Could not find a struct or enum called `" + typeName + "`"),
+		textLocation: location,
+	}
+}
+
+// Gets the number that `variant` of the enum called `enumName` is stored as
+func findEnumVariant(
+	names *namesInScope,
+	enumName string,
+	variant string,
+	location textLocation,
+) (numberValue[uint64], codeParsingError) {
+	for index, variantDefinition := range names.enums[enumName].variants {
+		if variantDefinition.name == variant {
+			return numberValue[uint64]{textLocation: location, value: uint64(index)}, codeParsingError{}
+		}
+	}
+	return numberValue[uint64]{}, codeParsingError{
+		msg:          errors.New("The enum `" + enumName + "` does not have a variant called `" + variant + "`"),
+		textLocation: location,
+	}
+}
+
+// Calculates the value of every constant in `AST`, and adds every global variable and buffer to the
+// data sections. The name of a global variable or buffer is a constant that is its address. A
+// constant can only use the constants that are declared before it.
+func (state *compilerState) evaluateConstants(
+	AST []topLevelASTitem,
+	globalFunctions map[string]functionDefinition,
+) (*namesInScope, []codeParsingError) {
+	names := &namesInScope{
+		constants: make(map[string]rawValue),
+		structs:   make(map[string]structLayout),
+		enums:     make(map[string]enumDefinition),
+	}
+	definitions := make(map[string]textLocation)
+	for _, ASTitem := range AST {
+		name := ""
+		switch definition := ASTitem.(type) {
+		case constantDefinition:
+			name = definition.name
+		case globalVariableDefinition:
+			name = definition.name
+		case bufferDefinition:
+			name = definition.name
+		case structDefinition:
+			name = definition.name
+		case enumDefinition:
+			name = definition.name
+		default:
+			continue
+		}
+		if _, exists := definitions[name]; exists {
+			errMsg := errors.New("Two declarations of `" + name + "`. Constants, global " +
+				"variables, buffers, structs, and enums can only be declared once.")
+			return nil, []codeParsingError{
+				{msg: errMsg, textLocation: definitions[name]},
+				{msg: errMsg, textLocation: ASTitem.location()},
+			}
+		}
+		if function, exists := globalFunctions[name]; exists {
+			errMsg := errors.New("A function and a constant, global variable, buffer, struct, or enum are both " +
+				"called `" + name + "`. Functions cannot have the same name as any of these.")
+			return nil, []codeParsingError{
+				{msg: errMsg, textLocation: function.textLocation},
+				{msg: errMsg, textLocation: ASTitem.location()},
+			}
+		}
+		definitions[name] = ASTitem.location()
+
+		switch definition := ASTitem.(type) {
+		case globalVariableDefinition:
+			err := state.addGlobalVariableToDataSection(definition, names)
+			if err.msg != nil {
+				return nil, []codeParsingError{err}
+			}
+			continue
+		case bufferDefinition:
+			err := state.addBufferToDataSection(definition, names)
+			if err.msg != nil {
+				return nil, []codeParsingError{err}
+			}
+			continue
+		case structDefinition:
+			layout, err := calculateStructLayout(definition)
+			if err.msg != nil {
+				return nil, []codeParsingError{err}
+			}
+			names.structs[definition.name] = layout
+			continue
+		case enumDefinition:
+			variants := make(map[string]textLocation)
+			for _, variant := range definition.variants {
+				if location, exists := variants[variant.name]; exists {
+					errMsg := errors.New("The enum `" + definition.name + "` has two variants called `" +
+						variant.name + "`")
+					return nil, []codeParsingError{
+						{msg: errMsg, textLocation: location},
+						{msg: errMsg, textLocation: variant.textLocation},
+					}
+				}
+				variants[variant.name] = variant.textLocation
+			}
+			names.enums[definition.name] = definition
+			continue
+		}
+		constant := ASTitem.(constantDefinition)
+		value, err := substituteConstantsInValue(constant.value, names)
+		if err.msg != nil {
+			return nil, []codeParsingError{err}
+		}
+		switch value := value.(type) {
+		case numberValue[uint64], numberValue[int64], numberValue[float64], characterValue, stringValue,
+			addressValue:
+			names.constants[constant.name] = value
+		case lengthValue:
+			names.constants[constant.name] = numberValue[uint64]{value: uint64(len(value.value.(stringValue).value))}
+		case variableValue:
+			return nil, []codeParsingError{{
+				msg: errors.New("Could not find a constant called `" + value.name + "`. A constant can " +
+					"only use the constants that are declared before it."),
+				textLocation: value.textLocation,
+			}}
+		default:
+			return nil, []codeParsingError{{
+				msg:          errors.New("The value of a constant must be known at compile time"),
+				textLocation: value.location(),
+			}}
+		}
+	}
+	return names, []codeParsingError{}
+}
+
+// The directives that store a number with each number of bits in a data section
+var dataDirectives = map[uint8]string{8: ".byte", 16: ".short", 32: ".long", 64: ".quad"}
+
+// Adds `variable` to the data section for values that start as 0 if it starts as 0, or to the data
+// section for initialised values otherwise. The variable is aligned to its size.
+func (state *compilerState) addGlobalVariableToDataSection(
+	variable globalVariableDefinition,
+	names *namesInScope,
+) codeParsingError {
+	label := state.createNewDataSectionLabel()
+	names.constants[variable.name] = addressValue{textLocation: variable.textLocation, label: label}
+	number := int64(0)
+	if variable.value != nil {
+		value, err := substituteConstantsInValue(variable.value, names)
+		if err.msg != nil {
+			return err
+		}
+		isNumber := false
+		number, isNumber = numberAtCompileTime(value)
+		if !isNumber {
+			return codeParsingError{
+				msg:          errors.New("The value of a global variable must be a number that is known at compile time"),
+				textLocation: value.location(),
+			}
+		}
+		if !numberFitsInBits(value, variable.size.bits) {
+			return codeParsingError{
+				msg:          errors.New("This value does not fit in the " + fmt.Sprint(variable.size.bits) + " bits of memory that it is stored in"),
+				textLocation: value.location(),
+			}
+		}
+	}
+	bytes := fmt.Sprint(variable.size.bits / 8)
+	if number == 0 {
+		state.zeroedDataSection += "\n.balign " + bytes + "\n" + label + ": .zero " + bytes
+	} else {
+		state.initialisedDataSection += "\n.balign " + bytes + "\n" + label + ": " +
+			dataDirectives[variable.size.bits] + " " + fmt.Sprint(number)
+	}
+	return codeParsingError{}
+}
+
+// Adds `buffer` to the data section for values that start as 0. Buffers are aligned to 16 bytes,
+// which is the largest alignment that any x86-64 instruction that is used by the compiler needs.
+func (state *compilerState) addBufferToDataSection(
+	buffer bufferDefinition,
+	names *namesInScope,
+) codeParsingError {
+	length, err := substituteConstantsInValue(buffer.length, names)
+	if err.msg != nil {
+		return err
+	}
+	number, isNumber := numberAtCompileTime(length)
+	if !isNumber || number <= 0 {
+		return codeParsingError{
+			msg:          errors.New("The number of bytes in a buffer must be a number that is more then 0, and is known at compile time"),
+			textLocation: length.location(),
+		}
+	}
+	label := state.createNewDataSectionLabel()
+	names.constants[buffer.name] = addressValue{textLocation: buffer.textLocation, label: label}
+	state.zeroedDataSection += "\n.balign 16\n" + label + ": .zero " + fmt.Sprint(number)
+	return codeParsingError{}
+}
+
+// Replaces every use of a constant in `block` with the value of the constant, and checks that
+// no variable in `block` has the same name as a constant
+func substituteConstantsInBlock(block []statement, names *namesInScope) []codeParsingError {
+	errs := []codeParsingError{}
+	for index, genericStatement := range block {
+		err := codeParsingError{}
+		switch statement := genericStatement.(type) {
+		case mutationStatement:
+			block[index], err = substituteConstantsInMutationStatement(statement, names)
+		case returnStatement:
+			err = substituteConstantsInArguments(statement.returnedValues, names)
+		case ifElseStatement:
+			if warning := unhandledEnumVariantsWarning(statement, names); warning.msg != nil {
+				add(&errs, warning)
+			}
+			statement, ifElseErrs := substituteConstantsInIfElseStatement(statement, names)
+			add(&errs, ifElseErrs...)
+			block[index] = statement
+		case whileLoop:
+			statement.condition, err = substituteConstantsInCondition(statement.condition, names)
+			add(&errs, substituteConstantsInBlock(statement.loopBody, names)...)
+			block[index] = statement
+		case deferStatement:
+			add(&errs, substituteConstantsInBlock(statement.block, names)...)
+		}
+		if err.msg != nil {
+			add(&errs, err)
+		}
+	}
+	return errs
+}
+
+// Replaces the constants in every block of an if/elif/else statement
+func substituteConstantsInIfElseStatement(
+	statement ifElseStatement,
+	names *namesInScope,
+) (ifElseStatement, []codeParsingError) {
+	errs := []codeParsingError{}
+	condition, err := substituteConstantsInCondition(statement.condition, names)
+	if err.msg != nil {
+		add(&errs, err)
+	}
+	statement.condition = condition
+	add(&errs, substituteConstantsInBlock(statement.ifBlock, names)...)
+	if elif, isElif := elifStatement(statement); isElif {
+		elif, elifErrs := substituteConstantsInIfElseStatement(elif, names)
+		add(&errs, elifErrs...)
+		statement.elseBlock[0] = elif
+	} else {
+		add(&errs, substituteConstantsInBlock(statement.elseBlock, names)...)
+	}
+	return statement, errs
+}
+
+// Gets the statement after `elif` if `statement` has an `elif` rather then an `else`
+func elifStatement(statement ifElseStatement) (ifElseStatement, bool) {
+	if len(statement.elseBlock) != 1 {
+		return ifElseStatement{}, false
+	}
+	elif, isIfElseStatement := statement.elseBlock[0].(ifElseStatement)
+	return elif, isIfElseStatement && elif.textLocation == statement.elseBlockLocation
+}
+
+// If every condition of an if/elif statement without an `else` compares a variable that stores an
+// enum to variants of the enum, like `state == State.Idle`, then this returns a warning about the
+// variants that are not handled by any of the conditions. Otherwise this returns no warning.
+func unhandledEnumVariantsWarning(statement ifElseStatement, names *namesInScope) codeParsingError {
+	location := statement.textLocation
+	variable := ""
+	handledVariants := make(map[string]bool)
+	for true {
+		comparisons := []condition{statement.condition}
+		if clauses, isBoolean := statement.condition.(boolean); isBoolean && !clauses.isAndInsteadOfOr {
+			comparisons = clauses.conditions
+		}
+		for _, untypedComparison := range comparisons {
+			comparison, isComparison := untypedComparison.(comparison)
+			if !isComparison || comparison.operator != Equal {
+				return codeParsingError{}
+			}
+			left, leftIsVariable := comparison.leftValue.(variableValue)
+			right, rightIsVariable := comparison.rightValue.(variableValue)
+			if !leftIsVariable || !rightIsVariable {
+				return codeParsingError{}
+			}
+			if left.field != "" {
+				left, right = right, left
+			}
+			enumName, storesEnum := names.variableEnums[left.name]
+			if !storesEnum || left.pointerDereferenceLayers > 0 || right.name != enumName ||
+				(variable != "" && left.name != variable) {
+				return codeParsingError{}
+			}
+			variable = left.name
+			handledVariants[right.field] = true
+		}
+		elif, isElif := elifStatement(statement)
+		if !isElif {
+			if len(statement.elseBlock) != 0 {
+				return codeParsingError{}
+			}
+			break
+		}
+		statement = elif
+	}
+
+	enum := names.enums[names.variableEnums[variable]]
+	unhandledVariants := []string{}
+	for _, variant := range enum.variants {
+		if !handledVariants[variant.name] {
+			add(&unhandledVariants, "`"+enum.name+"."+variant.name+"`")
+		}
+	}
+	if len(unhandledVariants) == 0 {
+		return codeParsingError{}
+	}
+	return codeParsingError{
+		msg: errors.New("`" + variable + "` might be " + strings.Join(unhandledVariants, " or ") +
+			", which is not handled by this if statement. Either add an `elif` for it, or add an `else`."),
+		textLocation: location,
+		isWarning:    true,
+	}
+}
+
+// Replaces the constants and struct fields in `statement`, and records the struct or enum of any
+// variable that is defined in `statement`
+func substituteConstantsInMutationStatement(
+	statement mutationStatement,
+	names *namesInScope,
+) (mutationStatement, codeParsingError) {
+	for _, destination := range statement.destination {
+		if _, isConstant := names.constants[destination.name]; isConstant {
+			return mutationStatement{}, constantUsedAsVariableError(destination.name, destination.textLocation)
+		}
+	}
+	operation, err := substituteConstantsInMutationOperation(statement.operation, names)
+	if err.msg != nil {
+		return mutationStatement{}, err
+	}
+	statement.operation = operation
+
+	// Replace struct fields with the memory that they are stored in
+	for index, destination := range statement.destination {
+		if destination.field == "" {
+			continue
+		}
+		field, err := findStructField(names, destination.name, destination.field, destination.textLocation)
+		if err.msg != nil {
+			return mutationStatement{}, err
+		}
+		statement.destination[index].dereferenceSize = field.size
+		statement.destination[index].offset.displacement = field.offset
+		statement.destination[index].field = ""
 	}
 
-	// Check that the function mutated regisers use the expected registers
-	err = checkRegisterListsAreTheSame(
-		mapList(functionExpectedMutatedRegisters, func(in registerAndNameAndLocation) Register {
-			return in.register
-		}),
-		mapList(destination, func(in variableMutationDestination) registerAndLocation {
-			return registerAndLocation{
-				register: in.register,
-				location: in.textLocation,
+	// Record the struct or enum of any variable that is defined. A variable that is set to another
+	// variable has the same struct or enum.
+	for _, destination := range statement.destination {
+		if destination.register == UnknownRegister || destination.name == "" ||
+			destination.pointerDereferenceLayers > 0 {
+			if destination.typeName != "" {
+				return mutationStatement{}, codeParsingError{
+					msg:          errors.New("A struct or enum can only be given to a variable where it is defined"),
+					textLocation: destination.textLocation,
+				}
+			}
+			continue
+		}
+		if destination.typeName != "" {
+			err = addVariableType(names, destination.name, destination.typeName, destination.textLocation)
+			if err.msg != nil {
+				return mutationStatement{}, err
+			}
+			continue
+		}
+		delete(names.variableStructs, destination.name)
+		delete(names.variableEnums, destination.name)
+		if setTo, isSetToRawValue := operation.(setToRawValue); isSetToRawValue {
+			source, isVariable := setTo.val.(variableValue)
+			if !isVariable || source.pointerDereferenceLayers > 0 {
+				continue
+			}
+			if structName, hasStruct := names.variableStructs[source.name]; hasStruct {
+				names.variableStructs[destination.name] = structName
+			}
+			if enumName, hasEnum := names.variableEnums[source.name]; hasEnum {
+				names.variableEnums[destination.name] = enumName
 			}
-		}),
-	)
-	if err.msg != nil {
-		return "", []codeParsingError{err}
-	}
-	for i, expectedMutatedRegister := range functionExpectedMutatedRegisters {
-		if expectedMutatedRegister.name == "" && destination[i].name != "" {
-			return "", []codeParsingError{{
-				textLocation: destination[i].textLocation,
-				msg: errors.New("Function call stores the final value that the r" +
-					fmt.Sprint(destination[i].register) + " register was mutated to in a new " +
-					"variable called `" + destination[i].name + "`, but the function " +
-					"definition does not guarantee that it will muatate that register."),
-			}}
 		}
 	}
+	return statement, codeParsingError{}
+}
 
-	// Return
-	return assemblyForArgs + "\n" + functionCallCode, []codeParsingError{}
+func constantUsedAsVariableError(name string, location textLocation) codeParsingError {
+	return codeParsingError{
+		msg:          errors.New("`" + name + "` is a constant, so it cannot be used as the name of a variable"),
+		textLocation: location,
+	}
 }
 
-func parseFunctionDefinitionRegisters(
-	mutatedRegisters []registerAndNameAndLocation,
-	functionArgs []registerAndNameAndLocation,
-) (registerState, []codeParsingError) {
-	out := registerState{}
+func substituteConstantsInMutationOperation(
+	untypedOperation mutationOperation,
+	names *namesInScope,
+) (mutationOperation, codeParsingError) {
+	err := codeParsingError{}
+	switch operation := untypedOperation.(type) {
+	case setToFunctionCallValue:
+		return operation, substituteConstantsInArguments(operation.functionArgs, names)
+	case setToRawValue:
+		operation.val, err = substituteConstantsInValue(operation.val, names)
+		return operation, err
+	case incrementByRawValue:
+		operation.val, err = substituteConstantsInValue(operation.val, names)
+		return operation, err
+	case decrementByRawValue:
+		operation.val, err = substituteConstantsInValue(operation.val, names)
+		return operation, err
+	case multiplyByRawValue:
+		operation.val, err = substituteConstantsInValue(operation.val, names)
+		return operation, err
+	case divideByRawValue:
+		operation.val, err = substituteConstantsInValue(operation.val, names)
+		return operation, err
+	case andByRawValue:
+		operation.val, err = substituteConstantsInValue(operation.val, names)
+		return operation, err
+	case orByRawValue:
+		operation.val, err = substituteConstantsInValue(operation.val, names)
+		return operation, err
+	case xorByRawValue:
+		operation.val, err = substituteConstantsInValue(operation.val, names)
+		return operation, err
+	case shiftLeftByRawValue:
+		operation.val, err = substituteConstantsInValue(operation.val, names)
+		return operation, err
+	case shiftRightByRawValue:
+		operation.val, err = substituteConstantsInValue(operation.val, names)
+		return operation, err
+	case setToNotOfRawValue:
+		operation.val, err = substituteConstantsInValue(operation.val, names)
+		return operation, err
+	}
+	return untypedOperation, codeParsingError{}
+}
 
-	// Parse the function mutated registers
-	for _, register := range mutatedRegisters {
-		// TODO: Check that the mutated registers do not have the same name
-		assert(notEq(register.register, -1))
-		if register.name != "" {
-			add(&out.functionReturnValueRegisters, register.register)
+// Replaces the constants in the values of function arguments or return statements
+func substituteConstantsInArguments(
+	arguments []registerAndRawValueAndLocation,
+	names *namesInScope,
+) codeParsingError {
+	for index := range arguments {
+		value, err := substituteConstantsInValue(arguments[index].value, names)
+		if err.msg != nil {
+			return err
 		}
-		if out.registers[register.register].registerWasDefinedAsMutableAt.line != 0 {
-			errMsg := errors.New("Register " + register.name + " used twice in mutated registers")
-			return registerState{}, []codeParsingError{
-				{msg: errMsg, textLocation: out.registers[register.register].registerWasDefinedAsMutableAt},
-				{msg: errMsg, textLocation: register.textLocation},
+		arguments[index].value = value
+	}
+	return codeParsingError{}
+}
+
+func substituteConstantsInCondition(
+	untypedCondition condition,
+	names *namesInScope,
+) (condition, codeParsingError) {
+	err := codeParsingError{}
+	switch condition := untypedCondition.(type) {
+	case comparison:
+		condition.leftValue, err = substituteConstantsInValue(condition.leftValue, names)
+		if err.msg != nil {
+			return nil, err
+		}
+		condition.rightValue, err = substituteConstantsInValue(condition.rightValue, names)
+		return condition, err
+	case boolean:
+		for index, clause := range condition.conditions {
+			condition.conditions[index], err = substituteConstantsInCondition(clause, names)
+			if err.msg != nil {
+				return nil, err
 			}
 		}
-		out.registers[register.register].registerWasDefinedAsMutableAt = register.textLocation
+		return condition, codeParsingError{}
+	case notCondition:
+		condition.condition, err = substituteConstantsInCondition(condition.condition, names)
+		return condition, err
 	}
+	return untypedCondition, codeParsingError{}
+}
 
-	// Parse the function args
-	for _, arg := range functionArgs {
-		assert(notEq(arg.register, -1))
-		assert(notEq(arg.name, ""))
-
-		// Check that the same register has not been used already
-		if out.registers[arg.register].variableName != "" {
-			errMsg := errors.New("Register " + arg.name + " used twice in function arguments. Each register can only be used once.")
-			return registerState{}, []codeParsingError{
-				{msg: errMsg, textLocation: out.registers[arg.register].variableNameWasDefinedAt},
-				{msg: errMsg, textLocation: arg.textLocation},
+// Replaces any constants in `untypedValue` with their values, and then calculates any arithmetic
+// where both of the values are known at compile time
+func substituteConstantsInValue(untypedValue rawValue, names *namesInScope) (rawValue, codeParsingError) {
+	err := codeParsingError{}
+	switch value := untypedValue.(type) {
+	case structSizeValue:
+		layout, isStruct := names.structs[value.structName]
+		if !isStruct {
+			return nil, codeParsingError{
+				msg:          errors.New("Could not find a struct called `" + value.structName + "`"),
+				textLocation: value.textLocation,
 			}
 		}
-
-		// Check that the same name has not been used already
-		for _, regState := range out.registers {
-			if regState.variableName == arg.name {
-				errMsg := errors.New("Variable name " + arg.name + " used twice in function arguments. Each variable name can only be used once.")
-				return registerState{}, []codeParsingError{
-					{msg: errMsg, textLocation: out.registers[arg.register].variableNameWasDefinedAt},
-					{msg: errMsg, textLocation: arg.textLocation},
+		return numberValue[uint64]{textLocation: value.textLocation, value: uint64(layout.size)}, codeParsingError{}
+	case variableValue:
+		if value.typeName != "" {
+			return nil, codeParsingError{
+				msg: errors.New("A struct or enum can only be given to a variable where it is defined, or to " +
+					"an argument in the head of a function"),
+				textLocation: value.textLocation,
+			}
+		}
+		if _, isEnum := names.enums[value.name]; isEnum && value.field != "" {
+			if value.variableIsDropped {
+				return nil, codeParsingError{
+					msg:          errors.New("`" + value.name + "." + value.field + "` is a variant of an enum, so it cannot be dropped"),
+					textLocation: value.textLocation,
 				}
 			}
+			return findEnumVariant(names, value.name, value.field, value.textLocation)
 		}
-
-		// Update registerStates
-		out.registers[arg.register].variableName = arg.name
-		out.registers[arg.register].variableNameWasDefinedAt = arg.textLocation
+		if value.field != "" {
+			field, err := findStructField(names, value.name, value.field, value.textLocation)
+			if err.msg != nil {
+				return nil, err
+			}
+			value.dereferenceSize = field.size
+			value.offset.displacement = field.offset
+			value.field = ""
+		}
+		if constant, isConstant := names.constants[value.name]; isConstant {
+			if value.pointerDereferenceLayers > 0 || value.variableIsDropped {
+				return nil, codeParsingError{
+					msg: errors.New("`" + value.name + "` is a constant, so it cannot be " +
+						"dereferenced or dropped"),
+					textLocation: value.textLocation,
+				}
+			}
+			return constantWithLocation(constant, value.textLocation), codeParsingError{}
+		}
+		if constant, isConstant := names.constants[value.offset.index]; isConstant {
+			number, isNumber := numberAtCompileTime(constant)
+			if !isNumber {
+				return nil, codeParsingError{
+					msg:          errors.New("`" + value.offset.index + "` is not a number, so it cannot be added to a memory address"),
+					textLocation: value.offset.indexLocation,
+				}
+			}
+			value.offset.displacement += number * int64(value.offset.scale)
+			if value.offset.displacement < math.MinInt32 || value.offset.displacement > math.MaxInt32 {
+				return nil, codeParsingError{
+					msg:          errors.New("The number that is added to a memory address must fit in 32 bits"),
+					textLocation: value.offset.indexLocation,
+				}
+			}
+			value.offset.index = ""
+		}
+		return value, codeParsingError{}
+	case lengthValue:
+		value.value, err = substituteConstantsInValue(value.value, names)
+		if err.msg != nil {
+			return nil, err
+		}
+		if _, isString := value.value.(stringValue); !isString {
+			return nil, codeParsingError{
+				msg:          errors.New("`len(...)` can only be used on a string, or a constant that is a string"),
+				textLocation: value.value.location(),
+			}
+		}
+		return value, codeParsingError{}
+	case arithmeticExpression:
+		value.left, err = substituteConstantsInValue(value.left, names)
+		if err.msg != nil {
+			return nil, err
+		}
+		value.right, err = substituteConstantsInValue(value.right, names)
+		if err.msg != nil {
+			return nil, err
+		}
+		return arithmeticResultAtCompileTime(value)
 	}
-
-	// Return
-	return out, []codeParsingError{}
+	return untypedValue, codeParsingError{}
 }
 
-func (state *compilerState) compileFunctionDefinition(
-	function functionDefinition,
-	siblingFunctions map[string]functionDefinition,
-) []codeParsingError {
-	assert(notEq(function.name, ""))
-
-	// Add the `functionName` key to the compiledFunctions hashmap so that when
-	// `compileBlockToAssembly()` calls `compileFunctionCall`, that does not call
-	// this function if the function being called is the current function being
-	// compiled to stop an infinite loop.
-	state.compiledFunctions[function.name] = compiledFunction{}
-
-	// Parse registers that the function mutates
-	regState, errs := parseFunctionDefinitionRegisters(function.mutatedRegisters, function.arguments)
-	if len(errs) != 0 {
-		return errs
+// Returns a copy of the value of a constant that has the location of where the constant is used,
+// so that any errors about the value point to the code that uses it
+func constantWithLocation(constant rawValue, location textLocation) rawValue {
+	switch value := constant.(type) {
+	case numberValue[uint64]:
+		value.textLocation = location
+		return value
+	case numberValue[int64]:
+		value.textLocation = location
+		return value
+	case numberValue[float64]:
+		value.textLocation = location
+		return value
+	case characterValue:
+		value.textLocation = location
+		return value
+	case stringValue:
+		value.textLocation = location
+		return value
+	case addressValue:
+		value.textLocation = location
+		return value
+	default:
+		panic("Unexpected internal state")
 	}
+}
 
-	// Compile the function
-	assembly, errs := state.compileBlockToAssembly(function.body, regState, siblingFunctions, assemblyForControlFlowKeywords{})
-	if len(errs) != 0 {
-		return errs
+// Calculates `expression` if both of its values are known at compile time, otherwise `expression`
+// is returned. Like the arithmetic that is done at runtime, the values are signed 64 bit numbers
+// that wrap around when they overflow.
+func arithmeticResultAtCompileTime(expression arithmeticExpression) (rawValue, codeParsingError) {
+	left, leftIsKnown := numberAtCompileTime(expression.left)
+	right, rightIsKnown := numberAtCompileTime(expression.right)
+	if !leftIsKnown || !rightIsKnown {
+		return expression, codeParsingError{}
 	}
-	assert(notEq(assembly, ""))
-	if assembly[len(assembly)-1] != '\\' {
-		// If the compiled assembly does not return at the end, then add a return
-		assembly += "\n\\"
+	result := int64(0)
+	switch expression.operator {
+	case "+":
+		result = left + right
+	case "-":
+		result = left - right
+	case "*":
+		result = left * right
+	case "/", "%":
+		if right == 0 {
+			return nil, codeParsingError{
+				msg:          errors.New("Cannot divide by 0"),
+				textLocation: expression.right.location(),
+			}
+		}
+		result = left / right
+		if expression.operator == "%" {
+			result = left % right
+		}
+	case "&":
+		result = left & right
+	case "|":
+		result = left | right
+	case "xor":
+		result = left ^ right
+	case "<<", ">>", ">>>":
+		if right < 0 || right > 63 {
+			return nil, codeParsingError{
+				msg:          errors.New("The number of bits to shift by must be a number from 0 to 63"),
+				textLocation: expression.right.location(),
+			}
+		}
+		result = map[string]int64{
+			"<<":  left << right,
+			">>":  left >> right,
+			">>>": int64(uint64(left) >> right),
+		}[expression.operator]
+	default:
+		panic("Unexpected internal state")
 	}
-	state.compiledFunctions[function.name] = compiledFunction{assembly: assembly}
-
-	// Return
-	return []codeParsingError{}
+	if result < 0 {
+		return numberValue[int64]{textLocation: expression.left.location(), value: result}, codeParsingError{}
+	}
+	return numberValue[uint64]{textLocation: expression.left.location(), value: uint64(result)}, codeParsingError{}
 }
 
 func compileAssembly(AST []topLevelASTitem) (string, []codeParsingError) {
@@ -795,6 +2975,42 @@ func compileAssembly(AST []topLevelASTitem) (string, []codeParsingError) {
 		globalFunctions[function.name] = function
 	}
 
+	// Replace every use of a constant with its value
+	state := compilerState{
+		compiledFunctions: make(map[string]compiledFunction),
+		stringLabels:      make(map[string]string),
+	}
+	names, errs := state.evaluateConstants(AST, globalFunctions)
+	if len(errs) != 0 {
+		return "", errs
+	}
+	for _, function := range globalFunctions {
+		names.variableStructs = make(map[string]string)
+		names.variableEnums = make(map[string]string)
+		for _, register := range append(function.arguments, function.mutatedRegisters...) {
+			if _, isConstant := names.constants[register.name]; isConstant {
+				add(&errs, constantUsedAsVariableError(register.name, register.textLocation))
+			}
+			if register.typeName != "" {
+				err := addVariableType(names, register.name, register.typeName, register.textLocation)
+				if err.msg != nil {
+					add(&errs, err)
+				}
+			}
+		}
+		add(&errs, substituteConstantsInBlock(function.body, names)...)
+	}
+	// Warnings do not stop the code from being compiled, so they are returned with the assembly
+	warnings := []codeParsingError{}
+	for _, err := range errs {
+		if err.isWarning {
+			add(&warnings, err)
+		}
+	}
+	if len(errs) != len(warnings) {
+		return "", errs
+	}
+
 	// Check that the main function exists
 	if _, exists := globalFunctions["main"]; !exists {
 		return "", []codeParsingError{{
@@ -805,26 +3021,95 @@ func compileAssembly(AST []topLevelASTitem) (string, []codeParsingError) {
 			msg: errors.New("Could not find main function definition"),
 		}}
 	}
+	if functionHasAnyRegisters(globalFunctions["main"]) {
+		return "", []codeParsingError{{
+			textLocation: globalFunctions["main"].textLocation,
+			msg:          errors.New("The main function cannot use `any` registers, since it is not called by a function that could choose them"),
+		}}
+	}
 
 	// Compile the main function into assembly that has `\` to return from
 	// functions, and `/FUNCTION_NAME/` to call other functions.
-	state := compilerState{compiledFunctions: make(map[string]compiledFunction)}
-	errs := state.compileFunctionDefinition(globalFunctions["main"], globalFunctions)
+	errs = state.compileFunctionDefinition(globalFunctions["main"], globalFunctions)
 	if len(errs) != 0 {
 		return "", errs
 	}
 
+	// The entry point calls main like any other function, and then exits the
+	// process. The exit status is the value that main returns in its first
+	// return register, or 0 if main does not return any values.
+	entry := state.compiledFunctions["main"]
+	entry.references++
+	state.compiledFunctions["main"] = entry
+	exitStatus := "$0"
+	for _, register := range globalFunctions["main"].mutatedRegisters {
+		if register.name != "" {
+			exitStatus = commonAssemblyRegisterToX86Register(register.register)
+			break
+		}
+	}
+
+	// Get the assembly to pass the program arguments and environment variables
+	// to main
+	loadArgumentsAssembly, err := getAssemblyForLoadingMainArguments(globalFunctions["main"].arguments)
+	if err.msg != nil {
+		return "", []codeParsingError{err}
+	}
+
 	// Compile the `\` to return from functions, and `/FUNCTION_NAME/` to call
 	// other functions into valid assembly.
-	// TODO: Change the return code for platforms other then linux X86-64
-	state.transformFunctionDefinitionIntoValidAssembly("main", "mov $60, %rax\nmov $0, %rdi\nsyscall")
+	// TODO: Change the exit code for platforms other then linux X86-64
+	entryPoint := "\n_start:" + loadArgumentsAssembly + "\n" +
+		state.getAssemblyForFunctionCall("main") +
+		"\nmovq " + exitStatus + ", %rdi\nmovq $60, %rax\nsyscall"
 
 	// Concatenate the output
-	out := ".global " + state.compiledFunctions["main"].jumpLabel + "\n.text" + state.dataSection
-	for _, function := range state.compiledFunctions {
-		out += function.assembly
+	out := ".global _start\n.text" + entryPoint
+	for _, functionName := range state.compiledFunctionNames {
+		out += state.compiledFunctions[functionName].assembly
+	}
+	if state.readOnlyDataSection != "" {
+		out += "\n.section .rodata" + state.readOnlyDataSection
+	}
+	if state.initialisedDataSection != "" {
+		out += "\n.data" + state.initialisedDataSection
+	}
+	if state.zeroedDataSection != "" {
+		out += "\n.bss" + state.zeroedDataSection
 	}
-	return out + "\n", []codeParsingError{}
+	return out + "\n", warnings
+}
+
+// Gets the assembly that loads the arguments of main from the stack that the
+// process starts with. On linux x86-64, the stack pointer points to the number
+// of program arguments. This is followed by a null terminated list of pointers
+// to the program arguments, and then a null terminated list of pointers to the
+// environment variables. The arguments of main are these values in order.
+func getAssemblyForLoadingMainArguments(arguments []registerAndNameAndLocation) (string, codeParsingError) {
+	if len(arguments) > 3 {
+		return "", codeParsingError{
+			textLocation: arguments[3].textLocation,
+			msg: errors.New("The main function can have at most 3 arguments: the number of " +
+				"program arguments, a pointer to the list of program arguments, and a pointer to " +
+				"the list of environment variables"),
+		}
+	}
+	assembly := ""
+	for i, argument := range arguments {
+		register := commonAssemblyRegisterToX86Register(argument.register)
+		switch i {
+		case 0:
+			assembly += "\nmovq (%rsp), " + register
+		case 1:
+			assembly += "\nleaq 8(%rsp), " + register
+		case 2:
+			// The environment variables start after the null pointer at the end of
+			// the program arguments
+			assembly += "\nleaq 16(%rsp," +
+				commonAssemblyRegisterToX86Register(arguments[0].register) + ",8), " + register
+		}
+	}
+	return assembly, codeParsingError{}
 }
 
 func (state *compilerState) transformFunctionDefinitionIntoValidAssembly(functionName string, returnAssembly string) {
@@ -838,11 +3123,7 @@ func (state *compilerState) transformFunctionDefinitionIntoValidAssembly(functio
 	// `getAssemblyForFunctionCall` if it calls this function, then the early
 	// return above can return before this function calls
 	// `getAssemblyForFunctionCall` again possibly starting an infinite loop.
-	if functionName == "main" {
-		functionDefinition.jumpLabel = "_start"
-	} else {
-		functionDefinition.jumpLabel = state.createNewJumpLabel()
-	}
+	functionDefinition.jumpLabel = state.createNewJumpLabel()
 	state.compiledFunctions[functionName] = functionDefinition
 
 	// Change `functionDefinition.assembly` so that it is valid assembly
@@ -945,7 +3226,9 @@ func (state *compilerState) convertValueToAssembly(regState *registerState, unty
 	// TODO: Add support for floats
 	// We do not need to handle `&variableName` since variables are registers, and it is not possible to have a pointer to a register
 	case numberValue[uint64]:
-		return "$" + fmt.Sprint(value.value), codeParsingError{}
+		// Numbers are written as the signed number with the same bits, so that a number like
+		// `0xffff_ffff_ffff_ffff` can be used as the 32 bit number `-1`
+		return "$" + fmt.Sprint(int64(value.value)), codeParsingError{}
 	case numberValue[int64]:
 		return "$" + fmt.Sprint(value.value), codeParsingError{}
 	case numberValue[float64]:
@@ -956,15 +3239,137 @@ func (state *compilerState) convertValueToAssembly(regState *registerState, unty
 		if err.msg != nil {
 			return "", err
 		}
-		return strings.Repeat("(", int(value.pointerDereferenceLayers)) +
-			commonAssemblyRegisterToX86Register(registerNumber) +
-			strings.Repeat(")", int(value.pointerDereferenceLayers)), codeParsingError{}
+		return memoryOperandToAssembly(regState, registerNumber, value.pointerDereferenceLayers, value.offset,
+			value.textLocation)
 	case stringValue:
-		dataSectionLabelForString := state.createNewDataSectionLabel()
-		state.dataSection += "\n" + dataSectionLabelForString + ": .ascii \"" + value.value + "\""
-		return "$" + dataSectionLabelForString, codeParsingError{}
+		label, isStored := state.stringLabels[value.value]
+		if !isStored {
+			label = state.createNewDataSectionLabel()
+			state.stringLabels[value.value] = label
+			state.readOnlyDataSection += "\n" + label + ": " + stringToAscizDirective(value.value)
+		}
+		return "$" + label, codeParsingError{}
+	case characterValue:
+		return "$" + fmt.Sprint(int64(characterToNumber(value.value))), codeParsingError{}
+	case lengthValue:
+		stringParsed, isString := value.value.(stringValue)
+		assert(eq(isString, true))
+		return "$" + fmt.Sprint(len(stringParsed.value)), codeParsingError{}
+	case addressValue:
+		return "$" + value.label, codeParsingError{}
+	default:
+		panic("Unexpected internal state")
+	}
+}
+
+// Converts a register that is dereferenced `pointerDereferenceLayers` times into an x86-64 operand
+// like `16(%rax,%rbx,8)`. `offset` is added to the register before it is dereferenced.
+func memoryOperandToAssembly(
+	regState *registerState,
+	register Register,
+	pointerDereferenceLayers uint,
+	offset memoryOffset,
+	location textLocation,
+) (string, codeParsingError) {
+	address := commonAssemblyRegisterToX86Register(register)
+	if pointerDereferenceLayers == 0 {
+		return address, codeParsingError{}
+	}
+	if pointerDereferenceLayers > 1 && (offset.index != "" || offset.displacement != 0) {
+		return "", codeParsingError{
+			msg: errors.New("On x86-64, a memory address that has an offset added to it cannot be " +
+				"dereferenced more then once. Load the pointer into a variable first, and then add the " +
+				"offset to that variable."),
+			textLocation: location,
+		}
+	}
+	if offset.index != "" {
+		indexRegister, err := getRegisterFromVariableName(regState, offset.index, false, offset.indexLocation)
+		if err.msg != nil {
+			return "", err
+		}
+		if indexRegister == 14 {
+			return "", codeParsingError{
+				msg:          errors.New("On x86-64, r14 cannot be added to a memory address as a variable, since it is the stack pointer"),
+				textLocation: offset.indexLocation,
+			}
+		}
+		address += "," + commonAssemblyRegisterToX86Register(indexRegister) + "," + fmt.Sprint(offset.scale)
+	}
+	displacement := ""
+	if offset.displacement != 0 {
+		displacement = fmt.Sprint(offset.displacement)
+	}
+	return displacement + strings.Repeat("(", int(pointerDereferenceLayers)) + address +
+		strings.Repeat(")", int(pointerDereferenceLayers)), codeParsingError{}
+}
+
+// Converts a string into an `.asciz` directive, which stores the string followed by a null byte so
+// that it can be passed to syscalls that need null terminated strings. Every byte that is not a
+// printable ascii character is written as an octal escape sequence, so that the assembler does not
+// have to interpret any common assembly escape sequences.
+func stringToAscizDirective(value string) string {
+	out := ".asciz \""
+	for index := 0; index < len(value); index++ {
+		switch character := value[index]; {
+		case character == '"' || character == '\\':
+			out += "\\" + string(character)
+		case ' ' <= character && character <= '~':
+			out += string(character)
+		default:
+			out += fmt.Sprintf("\\%03o", character)
+		}
+	}
+	return out + "\""
+}
+
+// Converts the bytes of a character into the number that a register would
+// contain if the character was loaded into it from memory
+func characterToNumber(value string) uint64 {
+	number := uint64(0)
+	for index := len(value) - 1; index >= 0; index-- {
+		number = number<<8 | uint64(value[index])
+	}
+	return number
+}
+
+// Returns the number that `value` evaluates to, and true if the number is known at compile time
+func numberAtCompileTime(value rawValue) (int64, bool) {
+	switch number := value.(type) {
+	case numberValue[uint64]:
+		return int64(number.value), true
+	case numberValue[int64]:
+		return number.value, true
 	case characterValue:
-		return "$'" + value.value + "'", codeParsingError{}
+		return int64(characterToNumber(number.value)), true
+	case lengthValue:
+		return int64(len(number.value.(stringValue).value)), true
+	}
+	return 0, false
+}
+
+// Returns the result of `condition`, and true if both of the values in `condition` are known at
+// compile time. Like the comparisons that are done at runtime, the values are compared as signed
+// numbers.
+func comparisonResultAtCompileTime(condition comparison) (bool, bool) {
+	left, leftIsKnown := numberAtCompileTime(condition.leftValue)
+	right, rightIsKnown := numberAtCompileTime(condition.rightValue)
+	if !leftIsKnown || !rightIsKnown {
+		return false, false
+	}
+	switch condition.operator {
+	case GreaterThan:
+		return left > right, true
+	case GreaterThanOrEqual:
+		return left >= right, true
+	case LessThan:
+		return left < right, true
+	case LessThanOrEqual:
+		return left <= right, true
+	case Equal:
+		return left == right, true
+	case NotEqual:
+		return left != right, true
 	default:
 		panic("Unexpected internal state")
 	}
@@ -1037,18 +3442,25 @@ func (state *compilerState) conditionToAssembly(
 		}
 		return out + "\n" + afterConditionJumpLabel + ":", codeParsingError{}
 
+	case notCondition:
+		// Negating a condition is the same as swapping where to jump to, so no instructions are needed
+		return state.conditionToAssembly(regState, condition.condition, jumpToOnFalse, jumpToOnTrue)
+
 	case comparison:
+		// A comparison between 2 numbers that are known at compile time does not need any instructions
+		if result, isKnown := comparisonResultAtCompileTime(condition); isKnown {
+			return state.conditionToAssembly(regState, booleanValue{
+				textLocation: condition.textLocation,
+				value:        result,
+			}, jumpToOnTrue, jumpToOnFalse)
+		}
+
 		out := ""
-		if !isValidLastOperandForMoveAndCmpInstructions(condition.rightValue) {
+		if !isValidLastOperandForMoveAndCmpInstructions(condition.rightValue) &&
+			isValidLastOperandForMoveAndCmpInstructions(condition.leftValue) {
 			// In AT&T assembly syntax, the second operator for the cmp instruction must
 			// either be a register or a memory operand, so we need need to flip the
 			// operators, and the greater then sign.
-			if !isValidLastOperandForMoveAndCmpInstructions(condition.leftValue) {
-				return "", codeParsingError{
-					msg:          errors.New("Comparisons must have at least 1 variable name or pointer to memory in them"),
-					textLocation: condition.textLocation,
-				}
-			}
 			condition.leftValue, condition.rightValue =
 				condition.rightValue, condition.leftValue
 			switch condition.operator {
@@ -1062,15 +3474,47 @@ func (state *compilerState) conditionToAssembly(
 				condition.operator = LessThanOrEqual
 			}
 		}
-		firstArg, err := state.convertValueToAssembly(regState, condition.leftValue)
-		if err.msg != nil {
-			return "", err
+		// Memory that is smaller then 64 bits can be compared directly with a number that fits in it,
+		// in which case unsigned memory is compared with unsigned jumps. Otherwise values that are
+		// read from memory that is smaller then 64 bits are loaded into registers, so that they can be
+		// compared with 64 bit values.
+		size := sizeOfValue(condition.rightValue)
+		compareSize := memoryAccessSize{bits: 64, isSigned: true}
+		if numberIsInRange(condition.leftValue, size) {
+			compareSize = size
 		}
-		secondArg, err := state.convertValueToAssembly(regState, condition.rightValue)
-		if err.msg != nil {
-			return "", err
+		rightValueIsExtended := size.bits != 64 && compareSize.bits == 64
+
+		// Move any values that x86-64 cannot compare directly into registers
+		scratch := scratchRegisters{regState: regState}
+		args := [2]string{}
+		for i, value := range []rawValue{condition.leftValue, condition.rightValue} {
+			valueAssembly, err := state.convertValueToAssembly(regState, value)
+			if err.msg != nil {
+				return "", err
+			}
+			legalisationReason := ""
+			switch {
+			case sizeOfValue(value).bits != 64 && compareSize.bits == 64:
+				legalisationReason = smallMemoryComparisonLegalisationReason
+			case i == 0 && valueIsMemory(value) && valueIsMemory(condition.rightValue) && !rightValueIsExtended:
+				legalisationReason = memoryToMemoryLegalisationReason
+			case i == 1 && !isValidLastOperandForMoveAndCmpInstructions(value):
+				legalisationReason = numberComparisonLegalisationReason
+			case !immediateFitsIn32Bits(valueAssembly):
+				legalisationReason = largeNumberLegalisationReason
+			}
+			if legalisationReason != "" {
+				register, err := scratch.takeToLegalise(value.location(), legalisationReason)
+				if err.msg != nil {
+					return "", err
+				}
+				out += loadIntoRegister(valueAssembly, sizeOfValue(value), register)
+				valueAssembly = commonAssemblyRegisterToX86Register(register)
+			}
+			args[i] = valueAssembly
 		}
-		out += "\ncmp " + firstArg + ", " + secondArg
+		out += "\ncmp" + instructionSuffix(compareSize.bits) + " " + args[0] + ", " + args[1]
 
 		var jumpOnTrueCmp, jumpOnFalseCmp string
 		switch condition.operator {
@@ -1095,6 +3539,10 @@ func (state *compilerState) conditionToAssembly(
 		default:
 			panic("Unexpected internal state")
 		}
+		if !compareSize.isSigned {
+			unsignedJumps := map[string]string{"jl": "jb", "jge": "jae", "jle": "jbe", "jg": "ja", "je": "je", "jne": "jne"}
+			jumpOnTrueCmp, jumpOnFalseCmp = unsignedJumps[jumpOnTrueCmp], unsignedJumps[jumpOnFalseCmp]
+		}
 		if jumpToOnTrue != "" {
 			out += "\n" + jumpOnTrueCmp + " " + jumpToOnTrue
 			if jumpToOnFalse != "" {
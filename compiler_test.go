@@ -2,6 +2,11 @@ package main
 
 import (
 	_ "embed"
+	"errors"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -51,145 +56,1419 @@ func TestInvalidFunctionArgs(t *testing.T) {
 var mainCommonAssemblyCode string
 var mainExpectedAssemblyCode = `.global _start
 .text
-dataSectionLabel1: .ascii "Enter your name: "
-dataSectionLabel2: .ascii "You entered: "
-dataSectionLabel3: .ascii "\nCounting from 0 to 9...\n"
-dataSectionLabel4: .ascii "\n"
-dataSectionLabel5: .ascii "Point is not on the screen\n"
-dataSectionLabel6: .ascii "Point is on the screen\n"
 _start:
-mov $1, %rdi
-mov $dataSectionLabel1, %rsi
-mov $17, %rdx
-mov $1, %rax
+jmp jumpLabel27
+jumpLabel26:
+movq $0, %rdi
+movq $60, %rax
 syscall
-mov $0, %rdi
-mov $12, %rax
+jumpLabel27:
+movq $1, %rdi
+movq $dataSectionLabel3, %rsi
+movq $17, %rdx
+movq $1, %rax
 syscall
-mov %rax, %r15
-mov %rax, %r14
-mov %rax, %r10
-jmp jumpLabel2
-jumpLabel1:
-cmp %r14, %r10
-jg jumpLabel4
-add $4096, %r10
-mov %r10, %rdi
-mov $12, %rax
-syscall
-jumpLabel4:
-mov $0, %rdi
-mov %r14, %rsi
-mov $1, %rdx
-mov $0, %rax
+movq $dataSectionLabel2, %rbx
+movq $0, %rsi
+call jumpLabel28
+movq %rax, %r15
+movq %rax, %r14
+jmp jumpLabel7
+jumpLabel6:
+movq $dataSectionLabel2, %rbx
+movq $1, %rsi
+call jumpLabel28
+movq $0, %rdi
+movq %r14, %rsi
+movq $1, %rdx
+movq $0, %rax
 syscall
-cmp $0, %rax
-jge jumpLabel5
-mov %rax, %rdi
-mov $60, %rax
+cmpq $0, %rax
+jge jumpLabel9
+movq %rax, %rdi
+movq $60, %rax
 syscall
+jmp jumpLabel10
+jumpLabel9:
+cmpq $0, %rax
+je jumpLabel12
+cmpb $10, (%r14)
+jne jumpLabel11
+jumpLabel12:
+jmp jumpLabel8
+jumpLabel11:
+jumpLabel10:
+incq %r14
+jumpLabel7:
 jmp jumpLabel6
-jumpLabel5:
-cmp $0, %rax
-je jumpLabel8
-cmp $'\n', (%r14)
-jne jumpLabel7
 jumpLabel8:
-jmp jumpLabel3
-jumpLabel7:
-jumpLabel6:
-add $8, %r14
-jumpLabel2:
-jmp jumpLabel1
-jumpLabel3:
-mov $1, %rdi
-mov $dataSectionLabel2, %rsi
-mov $13, %rdx
-mov $1, %rax
+movq $1, %rdi
+movq $dataSectionLabel4, %rsi
+movq $13, %rdx
+movq $1, %rax
 syscall
-mov %r14, %rdx
-sub %r15, %rdx
-mov $1, %rdi
-mov %r15, %rsi
-mov $1, %rax
+movq %r14, %rdx
+subq %r15, %rdx
+movq $1, %rdi
+movq %r15, %rsi
+movq $1, %rax
 syscall
-mov %r15, %rdi
-add $4096, %rdi
-mov $12, %rax
+movq $dataSectionLabel2, %rbx
+jmp jumpLabel30
+jumpLabel29:
+movq $1, %rdi
+movq $dataSectionLabel5, %rsi
+movq $25, %rdx
+movq $1, %rax
 syscall
-mov $1, %rdi
-mov $dataSectionLabel3, %rsi
-mov $25, %rdx
-mov $1, %rax
+movq $dataSectionLabel1, %rsi
+jmp jumpLabel15
+jumpLabel14:
+movq $1, %rdi
+movq $1, %rdx
+movq $1, %rax
 syscall
-mov %r15, %rsi
-mov $'0', (%rsi)
-jmp jumpLabel10
-jumpLabel9:
-mov $1, %rdi
-mov $1, %rdx
-mov $1, %rax
+incb (%rsi)
+movq $dataSectionLabel6, %rsi
+movq $1, %rdi
+movq $1, %rdx
+movq $1, %rax
 syscall
-inc (%rsi)
-mov $dataSectionLabel4, %rsi
-mov $1, %rdi
-mov $1, %rdx
-mov $1, %rax
+movq $dataSectionLabel1, %rsi
+cmpb $57, (%rsi)
+jbe jumpLabel17
+jmp jumpLabel16
+jumpLabel17:
+jumpLabel15:
+jmp jumpLabel14
+jumpLabel16:
+movq $300, %rax
+movq $30, %rbx
+movq $100, %rcx
+movq $250, %rdx
+movq $0, %rsi
+jmp jumpLabel32
+jumpLabel31:
+cmpq $0, %rax
+jne jumpLabel24
+movq $1, %rdi
+movq $dataSectionLabel7, %rsi
+movq $27, %rdx
+movq $1, %rax
 syscall
-mov %r15, %rsi
-cmp $'9', (%rsi)
-jle jumpLabel12
-jmp jumpLabel11
-jumpLabel12:
-jumpLabel10:
-jmp jumpLabel9
-jumpLabel11:
-mov $300, %rax
-mov $30, %rbx
-mov $100, %rcx
-mov $250, %rdx
-mov $0, %rsi
-jmp jumpLabel22
-jumpLabel21:
-cmp $0, %rax
-jne jumpLabel19
-mov $1, %rdi
-mov $dataSectionLabel5, %rsi
-mov $27, %rdx
-mov $1, %rax
+jmp jumpLabel25
+jumpLabel24:
+movq $1, %rdi
+movq $dataSectionLabel8, %rsi
+movq $23, %rdx
+movq $1, %rax
 syscall
-jmp jumpLabel20
-jumpLabel19:
-mov $1, %rdi
-mov $dataSectionLabel6, %rsi
-mov $23, %rdx
-mov $1, %rax
+jumpLabel25:
+jmp jumpLabel26
+jumpLabel28:
+cmpq $dataSectionLabel2, %rbx
+jne jumpLabel1
+cmpq $0, 16(%rbx)
+jne jumpLabel1
+jumpLabel2:
+movq $0, %rdi
+movq $12, %rax
 syscall
-jumpLabel20:
-mov $60, %rax
-mov $0, %rdi
+movq %rax, (%rbx)
+movq %rax, 8(%rbx)
+movq %rax, 16(%rbx)
+jumpLabel1:
+movq 8(%rbx), %rdi
+addq %rsi, %rdi
+cmpq %rdi, 16(%rbx)
+jge jumpLabel3
+cmpq $dataSectionLabel2, %rbx
+je jumpLabel4
+movq $-12, %rax
+ret
+jumpLabel4:
+addq $4095, %rdi
+andq $-4096, %rdi
+movq $12, %rax
 syscall
-jumpLabel22:
-cmp $0, %rsi
-jne jumpLabel14
-cmp $0, %rax
-jl jumpLabel13
-cmp %rax, %rcx
-jle jumpLabel13
-jumpLabel16:
-cmp $0, %rbx
-jl jumpLabel13
-cmp %rbx, %rdx
-jle jumpLabel13
-jumpLabel17:
-jumpLabel15:
-jumpLabel14:
-mov $1, %rax
-jmp jumpLabel21
-jmp jumpLabel18
+cmpq %rax, %rdi
+jle jumpLabel5
+movq $-12, %rax
+ret
+jumpLabel5:
+movq %rdi, 16(%rbx)
+movq 8(%rbx), %rdi
+addq %rsi, %rdi
+jumpLabel3:
+movq 8(%rbx), %rax
+movq %rdi, 8(%rbx)
+movq %rax, %rax
+ret
+jumpLabel30:
+movq (%rbx), %rdi
+movq %rdi, 8(%rbx)
+cmpq $dataSectionLabel2, %rbx
+jne jumpLabel13
+movq $12, %rax
+syscall
+movq %rdi, 16(%rbx)
 jumpLabel13:
-mov $0, %rax
-jmp jumpLabel21
+jmp jumpLabel29
+jumpLabel32:
+cmpq $0, %rsi
+jne jumpLabel19
+cmpq $0, %rax
+jl jumpLabel18
+cmpq %rax, %rcx
+jle jumpLabel18
+jumpLabel21:
+cmpq $0, %rbx
+jl jumpLabel18
+cmpq %rbx, %rdx
+jle jumpLabel18
+jumpLabel22:
+jumpLabel20:
+jumpLabel19:
+movq $1, %rax
+jmp jumpLabel31
+jmp jumpLabel23
 jumpLabel18:
-jmp jumpLabel21
+movq $0, %rax
+jmp jumpLabel31
+jumpLabel23:
+jmp jumpLabel31
+.section .rodata
+dataSectionLabel3: .asciz "Enter your name: "
+dataSectionLabel4: .asciz "You entered: "
+dataSectionLabel5: .asciz "\012Counting from 0 to 9...\012"
+dataSectionLabel6: .asciz "\012"
+dataSectionLabel7: .asciz "Point is not on the screen\012"
+dataSectionLabel8: .asciz "Point is on the screen\012"
+.data
+.balign 1
+dataSectionLabel1: .byte 48
+.bss
+.balign 16
+dataSectionLabel2: .zero 24
 `
+
+func TestDropVariableInEveryBranch(t *testing.T) {
+	code := `
+		fn r0, r1, r2, r5, r9 = main() {
+			r1 status = 3
+			if status == 0 {
+				drop status
+				r1 result = 0
+			} elif status == 1 {
+				drop status
+				r1 result = 1
+			} else {
+				drop status
+				r1 result = 2
+			}
+			r0 = sysExit(r5=drop result)
+		}
+	`
+	_, errs := codeToAssembly(code, t.Log)
+	if printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log) {
+		t.FailNow()
+	}
+}
+
+func TestDropVariableInSomeBranches(t *testing.T) {
+	code := `
+		fn r0, r1, r2, r5, r9 = main() {
+			r1 status = 3
+			if status == 0 {
+				drop status
+			} else {
+				r0 = sysExit(r5=1)
+			}
+		}
+	`
+	_, errs := codeToAssembly(code, t.Log)
+	if len(errs) != 1 {
+		printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log)
+		t.Fatal("Expected exactly one error, got", len(errs))
+	}
+	if errs[0].line != 6 || errs[0].column != 6 {
+		t.Fatal("Expected an error at the else branch on line 6 and column 6, but it was at line", errs[0].line, "and column", errs[0].column)
+	}
+}
+
+func TestAnyRegisters(t *testing.T) {
+	code := `
+		fn r0, r2, r3, r4, r5, r9 = main() {
+			r3 a = 7
+			r3 a = double(drop a)
+			r4 b = 5
+			r4 b = double(drop b)
+			r4 b = double(drop b)
+			r0 = sysExit(r5=drop a)
+		}
+
+		fn any result = double(any=number) {
+			number += number
+			return any=number
+		}
+	`
+	assembly, errs := codeToAssembly(code, t.Log)
+	if printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log) {
+		t.FailNow()
+	}
+	// `double` should be compiled once for r3, and once for r4
+	if strings.Count(assembly, "\naddq %rdx, %rdx") != 1 || strings.Count(assembly, "\naddq %rsi, %rsi") != 1 {
+		t.Fatalf("Expected one copy of `double` for each register it is called with, got:\n%s", assembly)
+	}
+	if strings.Count(assembly, "\ncall ") != 2 {
+		t.Fatalf("Expected the copy of `double` that uses r4 to be called twice, got:\n%s", assembly)
+	}
+}
+
+func TestMainReturnsExitStatus(t *testing.T) {
+	code := `
+		fn r0 status = main() {
+			r0 status = callMain()
+			return r0=status
+		}
+
+		fn r0 status = callMain() {
+			r0 status = main()
+			return r0=status
+		}
+	`
+	assembly, errs := codeToAssembly(code, t.Log)
+	if printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log) {
+		t.FailNow()
+	}
+	if !strings.Contains(assembly, "\n_start:\ncall ") {
+		t.Fatalf("Expected the entry point to call main, since main is also called by callMain, got:\n%s", assembly)
+	}
+	if !strings.Contains(assembly, "\nmovq %rax, %rdi\nmovq $60, %rax\nsyscall") {
+		t.Fatalf("Expected the entry point to exit with the value main returns in r0, got:\n%s", assembly)
+	}
+}
+
+func TestMainArguments(t *testing.T) {
+	code := `
+		fn r0 status = main(r5=argc, r4=argv, r3=envp) {
+			return r0=argc
+		}
+	`
+	assembly, errs := codeToAssembly(code, t.Log)
+	if printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log) {
+		t.FailNow()
+	}
+	if !strings.Contains(assembly, "\n_start:\nmovq (%rsp), %rdi\nleaq 8(%rsp), %rsi\nleaq 16(%rsp,%rdi,8), %rdx\n") {
+		t.Fatalf("Expected the entry point to load argc, argv, and envp, got:\n%s", assembly)
+	}
+}
+
+func TestStringLength(t *testing.T) {
+	code := `
+		fn r0 status, r1, r2, r3, r4, r5, r9 = main() {
+			r0 = ignore sysWrite(r5=1, r4="a\tb\n", r3=len("a\tb\n"))
+			r1 length = len("\\\x41")
+			if drop length == len("ab") {
+				return r0=0
+			}
+			return r0=1
+		}
+	`
+	assembly, errs := codeToAssembly(code, t.Log)
+	if printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log) {
+		t.FailNow()
+	}
+	if !strings.Contains(assembly, "movq $4, %rdx\n") {
+		t.Fatalf("Expected the length of \"a\\tb\\n\" to be 4, got:\n%s", assembly)
+	}
+	if !strings.Contains(assembly, "movq $2, %rbx\n") {
+		t.Fatalf("Expected the length of \"\\\\\\x41\" to be 2, got:\n%s", assembly)
+	}
+}
+
+func TestEscapeSequences(t *testing.T) {
+	code := `
+		fn r0 status, r1, r2, r3, r4, r5, r9 = main() {
+			r0 = ignore sysWrite(r5=1, r4="say \"hi\"\x21\u{e9}\0\\", r3=len("say \"hi\"\x21\u{e9}\0\\"))
+			r1 character = '\''
+			return r0=0
+		}
+	`
+	assembly, errs := codeToAssembly(code, t.Log)
+	if printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log) {
+		t.FailNow()
+	}
+	if !strings.Contains(assembly, `.asciz "say \"hi\"!\303\251\000\\"`) {
+		t.Fatalf("Expected the escape sequences in the string to be decoded, got:\n%s", assembly)
+	}
+	if !strings.Contains(assembly, "movq $13, %rdx\n") || !strings.Contains(assembly, "movq $39, %rbx\n") {
+		t.Fatalf("Expected the escape sequences to be decoded before they are counted, got:\n%s", assembly)
+	}
+}
+
+func TestInvalidEscapeSequence(t *testing.T) {
+	code := `
+		fn r0, r3, r4, r5 = main() {
+			r0 = sysWrite(r5=1, r4="Hello\q", r3=6)
+		}
+	`
+	_, errs := codeToAssembly(code, t.Log)
+	if len(errs) != 1 {
+		printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log)
+		t.Fatal("Expected exactly one error, got", len(errs))
+	}
+	if errs[0].line != 3 || errs[0].column != 33 {
+		t.Fatal("Expected an error at `\\q` on line 3 and column 33, but it was at line", errs[0].line, "and column", errs[0].column)
+	}
+}
+
+func TestNumberLiterals(t *testing.T) {
+	code := `
+		fn r0 status, r1 = main() {
+			r1 number = 0xff
+			number += 0b1_0000
+			number -= 0o17
+			number += 1_000
+			number -= -0x2
+			number += 010
+			return r0=drop number
+		}
+	`
+	assembly, errs := codeToAssembly(code, t.Log)
+	if printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log) {
+		t.FailNow()
+	}
+	expected := "movq $255, %rbx\naddq $16, %rbx\nsubq $15, %rbx\naddq $1000, %rbx\nsubq $-2, %rbx\naddq $10, %rbx\n"
+	if !strings.Contains(assembly, expected) {
+		t.Fatalf("Expected the assembly to contain:\n%s\nbut got:\n%s", expected, assembly)
+	}
+}
+
+func TestOutOfRangeNumber(t *testing.T) {
+	code := `
+		fn r0 status = main() {
+			return r0=0x1_0000_0000_0000_0000
+		}
+	`
+	_, errs := codeToAssembly(code, t.Log)
+	if len(errs) != 1 {
+		printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log)
+		t.Fatal("Expected exactly one error, got", len(errs))
+	}
+	if errs[0].line != 3 || errs[0].column != 14 {
+		t.Fatal("Expected an error at the number on line 3 and column 14, but it was at line", errs[0].line, "and column", errs[0].column)
+	}
+}
+
+func TestBitwiseOperators(t *testing.T) {
+	code := `
+		fn r0 status, r1, r2 = main() {
+			r1 bits = 0xf0
+			bits |= 0x0f
+			bits &= 0x3c
+			bits xor= 1
+			r2 amount = 2
+			bits <<= drop amount
+			bits >>= 1
+			bits >>>= 1
+			bits = not bits
+			return r0=drop bits
+		}
+	`
+	assembly, errs := codeToAssembly(code, t.Log)
+	if printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log) {
+		t.FailNow()
+	}
+	expected := "orq $15, %rbx\nandq $60, %rbx\nxorq $1, %rbx\nmovq $2, %rcx\nshlq %cl, %rbx\nsarq $1, %rbx\nshrq $1, %rbx\nnotq %rbx\n"
+	if !strings.Contains(assembly, expected) {
+		t.Fatalf("Expected the assembly to contain:\n%s\nbut got:\n%s", expected, assembly)
+	}
+}
+
+func TestShiftByVariableThatIsNotInR2(t *testing.T) {
+	code := `
+		fn r0 status, r1, r3 = main() {
+			r1 bits = 1
+			r3 amount = 2
+			bits <<= drop amount
+			return r0=drop bits
+		}
+	`
+	_, errs := codeToAssembly(code, t.Log)
+	if len(errs) != 1 {
+		printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log)
+		t.Fatal("Expected exactly one error, got", len(errs))
+	}
+	if errs[0].line != 5 || errs[0].column != 13 {
+		t.Fatal("Expected an error at `drop amount` on line 5 and column 13, but it was at line", errs[0].line, "and column", errs[0].column)
+	}
+}
+
+func TestArithmeticExpressions(t *testing.T) {
+	code := `
+		fn r0 status, r1, r2, r3, r4 = main() {
+			r1 width = 7
+			r2 height = 5
+			r3 area = width * (height + 4) - 1
+			area /= drop width
+			drop height
+			return r0=drop area
+		}
+	`
+	assembly, errs := codeToAssembly(code, t.Log)
+	if printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log) {
+		t.FailNow()
+	}
+	expected := "movq %rbx, %rdx\nmovq %rcx, %rsi\naddq $4, %rsi\nimulq %rsi, %rdx\nsubq $1, %rdx\n" +
+		"movq %rdx, %rax\ncqo\nidivq %rbx\nmovq %rax, %rdx\n"
+	if !strings.Contains(assembly, expected) {
+		t.Fatalf("Expected the assembly to contain:\n%s\nbut got:\n%s", expected, assembly)
+	}
+}
+
+func TestSubtractionWithoutSpaces(t *testing.T) {
+	code := `
+		fn r0 status, r1 = main() {
+			r1 a = 5
+			r0 status = a-1
+			drop a
+			return r0=drop status
+		}
+	`
+	assembly, errs := codeToAssembly(code, t.Log)
+	if printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log) {
+		t.FailNow()
+	}
+	expected := "movq %rbx, %rax\nsubq $1, %rax\n"
+	if !strings.Contains(assembly, expected) {
+		t.Fatalf("Expected the assembly to contain:\n%s\nbut got:\n%s", expected, assembly)
+	}
+}
+
+func TestXorExpression(t *testing.T) {
+	code := `
+		fn r0 status, r1 = main() {
+			r1 a = 5
+			r0 status = a xor 3 & 6 | 8
+			drop a
+			return r0=drop status
+		}
+	`
+	assembly, errs := codeToAssembly(code, t.Log)
+	if printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log) {
+		t.FailNow()
+	}
+	// `&` is calculated before `xor`, and `xor` before `|`
+	expected := "movq %rbx, %rax\nxorq $2, %rax\norq $8, %rax\n"
+	if !strings.Contains(assembly, expected) {
+		t.Fatalf("Expected the assembly to contain:\n%s\nbut got:\n%s", expected, assembly)
+	}
+}
+
+func TestDivisionInsideExpression(t *testing.T) {
+	code := `
+		fn r0 status, r1, r2, r3 = main(r1=a) {
+			a = a - a / 3
+			return r0=0
+		}
+	`
+	assembly, errs := codeToAssembly(code, t.Log)
+	if printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log) {
+		t.FailNow()
+	}
+	expected := "movq %rbx, %rcx\nmovq %rcx, %rax\nmovq $3, %rcx\ncqo\nidivq %rcx\nmovq %rax, %rcx\nsubq %rcx, %rbx\n"
+	if !strings.Contains(assembly, expected) {
+		t.Fatalf("Expected the assembly to contain:\n%s\nbut got:\n%s", expected, assembly)
+	}
+}
+
+func TestDivisionAfterValueInR0(t *testing.T) {
+	code := `
+		fn r0 status, r1, r2, r3, r4, r5 = main() {
+			r1 a = 50
+			r2 c = 4
+			r0 status = c * 2 - a / 10
+			drop a
+			drop c
+			return r0=status
+		}
+	`
+	_, exitStatus := runCode(t, code)
+	if exitStatus != 3 {
+		t.Fatal("Expected the program to exit with 3, but it exited with", exitStatus)
+	}
+}
+
+func TestArithmeticWithoutFreeRegisters(t *testing.T) {
+	code := `
+		fn r0 status, r1, r2 = main() {
+			r1 width = 7
+			r2 height = 5
+			r0 area = width * (height + 4)
+			drop width
+			drop height
+			return r0=drop area
+		}
+	`
+	_, errs := codeToAssembly(code, t.Log)
+	if len(errs) != 1 {
+		printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log)
+		t.Fatal("Expected exactly one error, got", len(errs))
+	}
+	if errs[0].line != 5 || errs[0].column != 30 {
+		t.Fatal("Expected an error at `+` on line 5 and column 30, but it was at line", errs[0].line, "and column", errs[0].column)
+	}
+}
+
+func TestConditionOrderOfOperations(t *testing.T) {
+	code := `
+		fn r0 status, r1, r2 = main() {
+			r1 a = 1
+			r2 b = 0
+			if a == 1 or b == 1 and not b == 0 {
+				drop a
+				drop b
+				return r0=0
+			}
+			drop a
+			drop b
+			return r0=1
+		}
+	`
+	assembly, errs := codeToAssembly(code, t.Log)
+	if printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log) {
+		t.FailNow()
+	}
+	// `a == 1` is checked first on its own, since `b == 1 and not b == 0` is calculated before `or`.
+	// `not` swaps the jumps for `b == 0` rather then adding any instructions.
+	expected := "cmpq $1, %rbx\nje jumpLabel2\ncmpq $1, %rcx\njne jumpLabel1\ncmpq $0, %rcx\nje jumpLabel1\n"
+	if !strings.Contains(assembly, expected) {
+		t.Fatalf("Expected the assembly to contain:\n%s\nbut got:\n%s", expected, assembly)
+	}
+}
+
+func TestUnclosedBracketInCondition(t *testing.T) {
+	code := `
+		fn r0 status, r1 = main() {
+			r1 a = 1
+			if (a == 1 or (a == 2) {
+				drop a
+				return r0=0
+			}
+			drop a
+			return r0=1
+		}
+	`
+	_, errs := codeToAssembly(code, t.Log)
+	if len(errs) != 1 {
+		printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log)
+		t.Fatal("Expected exactly one error, got", len(errs))
+	}
+	if errs[0].line != 4 || errs[0].column != 7 {
+		t.Fatal("Expected an error at the unclosed `(` on line 4 and column 7, but it was at line", errs[0].line, "and column", errs[0].column)
+	}
+}
+
+func TestLabeledBreakAndContinue(t *testing.T) {
+	code := `
+		fn r0 status, r1, r2 = main() {
+			r1 i = 0
+			outer: while i < 10 {
+				i++
+				r2 j = 0
+				while j < 10 {
+					j++
+					if j == 3 {
+						continue outer
+					}
+					break outer
+				}
+				drop j
+			}
+			return r0=i
+		}
+	`
+	assembly, errs := codeToAssembly(code, t.Log)
+	if printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log) {
+		t.FailNow()
+	}
+	// The outer loop uses jumpLabel1 to jumpLabel3, so `continue outer` jumps to the outer loop's
+	// condition, and `break outer` jumps to the end of the outer loop.
+	expected := "\njmp jumpLabel2\njumpLabel7:\njmp jumpLabel3\n"
+	if !strings.Contains(assembly, expected) {
+		t.Fatalf("Expected the assembly to contain:\n%s\nbut got:\n%s", expected, assembly)
+	}
+}
+
+func TestBreakWithUnknownLoopLabel(t *testing.T) {
+	code := `
+		fn r0 status = main() {
+			outer: while true {
+				break outer
+			}
+			while true {
+				break outer
+			}
+			return r0=0
+		}
+	`
+	_, errs := codeToAssembly(code, t.Log)
+	if len(errs) != 1 {
+		printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log)
+		t.Fatal("Expected exactly one error, got", len(errs))
+	}
+	if errs[0].line != 7 || errs[0].column != 5 {
+		t.Fatal("Expected an error at `break` on line 7 and column 5, but it was at line", errs[0].line, "and column", errs[0].column)
+	}
+}
+
+func TestSizedMemoryAccess(t *testing.T) {
+	code := `
+		fn r0 status, r1, r2, r3 = main(r1=buffer) {
+			r2 unsigned = ^u8 buffer
+			r3 signed = ^i16 buffer
+			^u8 buffer = 5
+			^u32 buffer += signed
+			^u8 buffer++
+			if ^u8 buffer > 200 {
+				drop unsigned
+				drop signed
+				return r0=1
+			}
+			drop unsigned
+			drop signed
+			return r0=0
+		}
+	`
+	assembly, errs := codeToAssembly(code, t.Log)
+	if printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log) {
+		t.FailNow()
+	}
+	// Comparing unsigned memory with a number uses unsigned jumps
+	expected := "movzbq (%rbx), %rcx\nmovswq (%rbx), %rdx\nmovb $5, (%rbx)\naddl %edx, (%rbx)\n" +
+		"incb (%rbx)\ncmpb $200, (%rbx)\njbe "
+	if !strings.Contains(assembly, expected) {
+		t.Fatalf("Expected the assembly to contain:\n%s\nbut got:\n%s", expected, assembly)
+	}
+}
+
+func TestNumberDoesNotFitInMemory(t *testing.T) {
+	code := `
+		fn r0 status, r1 = main(r1=buffer) {
+			^u8 buffer = 256
+			return r0=0
+		}
+	`
+	_, errs := codeToAssembly(code, t.Log)
+	if len(errs) != 1 {
+		printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log)
+		t.Fatal("Expected exactly one error, got", len(errs))
+	}
+	if errs[0].line != 3 || errs[0].column != 17 {
+		t.Fatal("Expected an error at `256` on line 3 and column 17, but it was at line", errs[0].line, "and column", errs[0].column)
+	}
+}
+
+func TestIndexedMemoryAccess(t *testing.T) {
+	code := `
+		fn r0 status, r1, r2, r3 = main(r1=list, r2=index) {
+			list[index * 8] = 5
+			^u8(list + index + 3) += 1
+			r3 value = list[16]
+			if list[8 * index - 8] == value {
+				drop value
+				return r0=1
+			}
+			drop value
+			return r0=0
+		}
+	`
+	assembly, errs := codeToAssembly(code, t.Log)
+	if printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log) {
+		t.FailNow()
+	}
+	expected := "movq $5, (%rbx,%rcx,8)\naddb $1, 3(%rbx,%rcx,1)\nmovq 16(%rbx), %rdx\n" +
+		"cmpq -8(%rbx,%rcx,8), %rdx\n"
+	if !strings.Contains(assembly, expected) {
+		t.Fatalf("Expected the assembly to contain:\n%s\nbut got:\n%s", expected, assembly)
+	}
+}
+
+func TestInvalidIndexScale(t *testing.T) {
+	code := `
+		fn r0 status, r1 = main(r1=list, r2=index) {
+			list[index * 3] = 5
+			return r0=0
+		}
+	`
+	_, errs := codeToAssembly(code, t.Log)
+	if len(errs) != 1 {
+		printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log)
+		t.Fatal("Expected exactly one error, got", len(errs))
+	}
+	if errs[0].line != 3 || errs[0].column != 17 {
+		t.Fatal("Expected an error at `3` on line 3 and column 17, but it was at line", errs[0].line, "and column", errs[0].column)
+	}
+}
+
+func TestDereferencedIndexedMemory(t *testing.T) {
+	code := `
+		fn r0 status = main(r1=list, r2=index) {
+			r0 status = ^list[index * 8]
+			return r0=status
+		}
+	`
+	_, errs := codeToAssembly(code, t.Log)
+	if len(errs) != 1 {
+		printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log)
+		t.Fatal("Expected exactly one error, got", len(errs))
+	}
+	if errs[0].line != 3 || errs[0].column != 16 {
+		t.Fatal("Expected an error at `^list` on line 3 and column 16, but it was at line", errs[0].line, "and column", errs[0].column)
+	}
+}
+
+func TestOperandLegalisation(t *testing.T) {
+	code := `
+		fn r0 status, r1, r2, r3, r4 = main(r1=a, r2=b) {
+			^a = ^b
+			r3 big = 0x1_0000_0000
+			big += 0x1_0000_0000
+			if 1 < 2 {
+				drop big
+				return r0=1
+			}
+			drop big
+			return r0=0
+		}
+	`
+	assembly, errs := codeToAssembly(code, t.Log)
+	if printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log) {
+		t.FailNow()
+	}
+	// r4 is the first register that is mutable and not used by a variable apart from the registers
+	// that divisions and shifts need, and the comparison is calculated at compile time
+	expected := "movq (%rcx), %rsi\nmovq %rsi, (%rbx)\nmovabsq $4294967296, %rdx\n" +
+		"movabsq $4294967296, %rsi\naddq %rsi, %rdx\nmovq $1, %rax\njmp "
+	if !strings.Contains(assembly, expected) {
+		t.Fatalf("Expected the assembly to contain:\n%s\nbut got:\n%s", expected, assembly)
+	}
+}
+
+func TestLegalisationWithoutFreeRegisters(t *testing.T) {
+	code := `
+		fn r0 status, r1 = main(r0=count, r1=a, r2=b) {
+			^a = ^b
+			return r0=0
+		}
+	`
+	_, errs := codeToAssembly(code, t.Log)
+	if len(errs) != 1 {
+		printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log)
+		t.Fatal("Expected exactly one error, got", len(errs))
+	}
+	if errs[0].line != 3 || errs[0].column != 9 {
+		t.Fatal("Expected an error at `^b` on line 3 and column 9, but it was at line", errs[0].line, "and column", errs[0].column)
+	}
+}
+
+func TestConstants(t *testing.T) {
+	code := `
+		const PAGE_SIZE = 4096
+		const MASK = PAGE_SIZE * 2 - 1
+		const GREETING = "hi\n"
+
+		fn r0 status, r1, r2, r3, r4, r5, r9 = main(r1=size) {
+			size += MASK
+			if size > PAGE_SIZE {
+				r0 = ignore sysWrite(r5=1, r4=GREETING, r3=len(GREETING))
+			}
+			return r0=0
+		}
+	`
+	assembly, errs := codeToAssembly(code, t.Log)
+	if printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log) {
+		t.FailNow()
+	}
+	expected := "addq $8191, %rbx\ncmpq $4096, %rbx\njle "
+	if !strings.Contains(assembly, expected) {
+		t.Fatalf("Expected the assembly to contain:\n%s\nbut got:\n%s", expected, assembly)
+	}
+	expected = "movq $1, %rdi\nmovq $dataSectionLabel1, %rsi\nmovq $3, %rdx\n"
+	if !strings.Contains(assembly, expected) {
+		t.Fatalf("Expected the assembly to contain:\n%s\nbut got:\n%s", expected, assembly)
+	}
+}
+
+func TestDuplicateConstant(t *testing.T) {
+	code := `
+		const SIZE = 8
+		const SIZE = 16
+		fn r0 = main() {}
+	`
+	_, errs := codeToAssembly(code, t.Log)
+	if len(errs) != 2 {
+		printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log)
+		t.Fatal("Expected exactly two errors, got", len(errs))
+	}
+	if errs[0].line != 2 || errs[1].line != 3 {
+		t.Fatal("Expected errors on lines 2 and 3, but they were on lines", errs[0].line, "and", errs[1].line)
+	}
+}
+
+func TestGlobalVariablesAndBuffers(t *testing.T) {
+	code := `
+		var counter: u64 = 5
+		var flag: u8
+		buffer scratch[64]
+
+		fn r0 status, r1 = main() {
+			r1 pointer = counter
+			^pointer += 1
+			pointer = scratch
+			^u8 pointer = 1
+			drop pointer
+			return r0=0
+		}
+	`
+	assembly, errs := codeToAssembly(code, t.Log)
+	if printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log) {
+		t.FailNow()
+	}
+	expected := "movq $dataSectionLabel1, %rbx\naddq $1, (%rbx)\nmovq $dataSectionLabel3, %rbx\nmovb $1, (%rbx)\n"
+	if !strings.Contains(assembly, expected) {
+		t.Fatalf("Expected the assembly to contain:\n%s\nbut got:\n%s", expected, assembly)
+	}
+	expected = "\n.data\n.balign 8\ndataSectionLabel1: .quad 5\n.bss\n.balign 1\ndataSectionLabel2: .zero 1\n" +
+		".balign 16\ndataSectionLabel3: .zero 64\n"
+	if !strings.HasSuffix(assembly, expected) {
+		t.Fatalf("Expected the assembly to end with:\n%s\nbut got:\n%s", expected, assembly)
+	}
+}
+
+func TestWriteToReadOnlyData(t *testing.T) {
+	code := `
+		fn r0 status, r1 = main() {
+			r1 message = "Hello"
+			message++
+			^u8 message = 'J'
+			return r0=0
+		}
+	`
+	_, errs := codeToAssembly(code, t.Log)
+	if len(errs) != 1 {
+		printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log)
+		t.Fatal("Expected exactly one error, got", len(errs))
+	}
+	if errs[0].line != 5 || errs[0].column != 4 {
+		t.Fatal("Expected an error at `^u8 message` on line 5 and column 4, but it was at line", errs[0].line, "and column", errs[0].column)
+	}
+}
+
+func TestWriteToReadOnlyDataInLaterLoopIteration(t *testing.T) {
+	code := `
+		buffer buf[8]
+
+		fn r0 status, r1 = main() {
+			r0 status = 0
+			r1 p = buf
+			while status < 2 {
+				^u8 p = 'x'
+				p = "hello"
+				status++
+			}
+			drop p
+			return r0=status
+		}
+	`
+	_, errs := codeToAssembly(code, t.Log)
+	if len(errs) != 1 || errs[0].line != 8 || errs[0].column != 5 {
+		printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log)
+		t.Fatal("Expected one error at `^u8 p` on line 8 and column 5, since `p` points to a string in the second iteration of the loop")
+	}
+}
+
+func TestStringInterning(t *testing.T) {
+	code := `
+		fn r0 status, r1, r2 = main() {
+			r1 first = "Hello\n"
+			r2 second = "Hello\n"
+			drop first
+			drop second
+			return r0=0
+		}
+	`
+	assembly, errs := codeToAssembly(code, t.Log)
+	if printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log) {
+		t.FailNow()
+	}
+	expected := "movq $dataSectionLabel1, %rbx\nmovq $dataSectionLabel1, %rcx\n"
+	if !strings.Contains(assembly, expected) {
+		t.Fatalf("Expected the assembly to contain:\n%s\nbut got:\n%s", expected, assembly)
+	}
+	expected = "\n.section .rodata\ndataSectionLabel1: .asciz \"Hello\\012\"\n"
+	if !strings.HasSuffix(assembly, expected) {
+		t.Fatalf("Expected the assembly to end with:\n%s\nbut got:\n%s", expected, assembly)
+	}
+}
+
+func TestStructFields(t *testing.T) {
+	code := `
+		struct Point {
+			x: i64
+			y: i32
+			visible: u8
+		}
+
+		fn r0 status, r1, r2 = main(r1=point: Point) {
+			point.y = -1
+			r2 copy = point
+			copy.visible = 1
+			r0 status = sizeof(Point)
+			status += copy.x
+			drop copy
+			return r0=status
+		}
+	`
+	assembly, errs := codeToAssembly(code, t.Log)
+	if printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log) {
+		t.FailNow()
+	}
+	// `y` is after the 8 bytes of `x`, and the size of the struct is rounded up to the 8 byte
+	// alignment of `x`
+	expected := "movl $-1, 8(%rbx)\nmovq %rbx, %rcx\nmovb $1, 12(%rcx)\nmovq $16, %rax\naddq (%rcx), %rax\n"
+	if !strings.Contains(assembly, expected) {
+		t.Fatalf("Expected the assembly to contain:\n%s\nbut got:\n%s", expected, assembly)
+	}
+}
+
+func TestUnknownStructField(t *testing.T) {
+	code := `
+		struct Point { x: i64, y: i64 }
+		fn r0 status, r1 = main(r1=point: Point) {
+			point.z = 5
+			return r0=0
+		}
+	`
+	_, errs := codeToAssembly(code, t.Log)
+	if len(errs) != 1 {
+		printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log)
+		t.Fatal("Expected exactly one error, got", len(errs))
+	}
+	if errs[0].line != 4 || errs[0].column != 4 {
+		t.Fatal("Expected an error at `point.z` on line 4 and column 4, but it was at line", errs[0].line, "and column", errs[0].column)
+	}
+}
+
+func TestEnums(t *testing.T) {
+	code := `
+		enum State { Idle, Running, Stopped }
+
+		fn r0 state, r1 = main(r1=previous: State) {
+			r0 state: State = previous
+			if state == State.Idle {
+				state = State.Running
+			} elif state == State.Running or state == State.Stopped {
+				state = State.Stopped
+			}
+			return r0=state
+		}
+	`
+	assembly, errs := codeToAssembly(code, t.Log)
+	// Every variant is handled, so there should not be any warnings
+	if len(errs) != 0 {
+		printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log)
+		t.FailNow()
+	}
+	expected := "cmpq $0, %rax\n"
+	if !strings.Contains(assembly, expected) || !strings.Contains(assembly, "movq $2, %rax\n") {
+		t.Fatalf("Expected the variants of the enum to be compiled to numbers, but got:\n%s", assembly)
+	}
+}
+
+func TestUnhandledEnumVariantWarning(t *testing.T) {
+	code := `
+		enum State { Idle, Running, Stopped }
+		fn r0 status, r1 = main(r1=state: State) {
+			r0 status = 0
+			if state == State.Idle {
+				status = 1
+			}
+			return r0=status
+		}
+	`
+	assembly, errs := codeToAssembly(code, t.Log)
+	if len(errs) != 1 || !errs[0].isWarning {
+		printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log)
+		t.Fatal("Expected a warning about the variants of `State` that are not handled")
+	}
+	if errs[0].line != 5 || errs[0].column != 4 {
+		t.Fatal("Expected the warning to be at line 5 and column 4, but it was at line", errs[0].line, "and column", errs[0].column)
+	}
+	if assembly == "" {
+		t.Fatal("Expected the code to still be compiled when there is a warning")
+	}
+}
+
+// Compiles `code`, and then assembles, links, and runs it. Returns what the program wrote to stdout
+// and its exit status. The test is skipped if the assembler or the linker cannot be found.
+func runCode(t *testing.T, code string) (string, int) {
+	for _, program := range []string{"as", "ld"} {
+		if _, err := exec.LookPath(program); err != nil {
+			t.Skip("Could not find `" + program + "`, which is needed to run the compiled code")
+		}
+	}
+	assembly, errs := codeToAssembly(code, t.Log)
+	if printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log) {
+		t.FailNow()
+	}
+	directory := t.TempDir()
+	err := os.WriteFile(filepath.Join(directory, "out.asm"), []byte(assembly), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, command := range [][]string{{"as", "out.asm", "-o", "out.o"}, {"ld", "out.o", "-o", "out"}} {
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Dir = directory
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("`%s` failed: %s\n%s", strings.Join(command, " "), err, out)
+		}
+	}
+	out, err := exec.Command(filepath.Join(directory, "out")).Output()
+	exitError := &exec.ExitError{}
+	if errors.As(err, &exitError) {
+		return string(out), exitError.ExitCode()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return string(out), 0
+}
+
+func TestArena(t *testing.T) {
+	code := `
+		import arena
+
+		fn r0 status, r1, r2, r3, r4, r5, r6, r7, r8, r9, r10, r11 = main() {
+			# The main arena
+			r0 first, r1, r2, r5, r9 = expandArena(r1=mainArena, r4=5000)
+			^u8 first = 1
+			r10 firstItem = drop first
+			r0 second, r1, r2, r5, r9 = expandArena(r1=mainArena, r4=8)
+			^second = 41
+			^second += ^u8 firstItem
+			r11 value = ^second
+			drop second
+			r0, r1, r2, r5, r9 = shrinkArena(r1=mainArena, r4=8)
+			r0, r1, r2, r5, r9 = resetArena(r1=mainArena)
+			drop firstItem
+
+			# An arena that is allocated
+			r0 myArena, r2, r3, r4, r5, r6, r7, r8, r9 = allocateArena(r4=64)
+			if myArena < 0 {
+				return r0=1
+			}
+			r1 arenaPointer = drop myArena
+			r0 item, arenaPointer, r2, r5, r9 = expandArena(arenaPointer, r4=64)
+			if drop item < 0 {
+				return r0=2
+			}
+			r0 item, arenaPointer, r2, r5, r9 = expandArena(arenaPointer, r4=1)
+			if drop item >= 0 {
+				return r0=3
+			}
+			r0, arenaPointer, r2, r5, r9 = resetArena(arenaPointer)
+			r0 item, arenaPointer, r2, r5, r9 = expandArena(arenaPointer, r4=64)
+			if drop item < 0 {
+				return r0=4
+			}
+			r0, r2, r4, r9 = deallocateArena(r5=drop arenaPointer)
+			return r0=value
+		}
+	`
+	_, exitStatus := runCode(t, code)
+	if exitStatus != 42 {
+		t.Fatal("Expected the program to exit with 42, but it exited with", exitStatus)
+	}
+}
+
+func TestImportUnknownModule(t *testing.T) {
+	code := `
+		import notAModule
+		fn r0 status = main() {
+			return r0=0
+		}
+	`
+	_, errs := codeToAssembly(code, t.Log)
+	if len(errs) != 1 || errs[0].line != 2 || errs[0].column != 3 {
+		printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log)
+		t.Fatal("Expected an error at line 2 and column 3 about the module that does not exist")
+	}
+}
+
+func TestNamesInImportedModules(t *testing.T) {
+	code := `
+		import arena
+		const OUT_OF_MEMORY = 5
+		fn r0 status, r1, r2, r4, r5, r9 = main() {
+			r0 item, r1, r2, r5, r9 = expandArena(r1=mainArena, r4=1)
+			drop item
+			return r0=OUT_OF_MEMORY
+		}
+	`
+	_, exitStatus := runCode(t, code)
+	if exitStatus != 5 {
+		t.Fatal("Expected the program to exit with 5, but it exited with", exitStatus)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	code := `
+		import format
+
+		fn r0 status, r1, r2, r3, r4, r5, r8, r9 = main() {
+			r0, r1, r2, r3, r4, r5, r8, r9 = printInt(r5=-1234)
+			r0, r2, r5, r9 = print(r4=" ", r3=1)
+			r0, r1, r2, r3, r4, r5, r8, r9 = printInt(r5=-0x8000_0000_0000_0000)
+			r0, r2, r5, r9 = print(r4=" ", r3=1)
+			r0, r1, r2, r3, r4, r5, r8, r9 = printUint(r5=0)
+			r0, r2, r5, r9 = print(r4=" ", r3=1)
+			r0, r1, r2, r3, r4, r5, r8, r9 = printUint(r5=-1)
+			r0, r2, r5, r9 = print(r4=" ", r3=1)
+			r0, r2, r3, r4, r5, r8, r9 = printHex(r5=0xbeef)
+			r0, r2, r5, r9 = print(r4=" ", r3=1)
+			r0, r2, r3, r4, r5, r8, r9 = printHex(r5=0)
+			r0, r2, r5, r9 = print(r4="\n", r3=1)
+
+			# Numbers that are written to a buffer can be read again
+			r0, r1, r2, r3 length, r4 text, r5, r8 = intToString(r5=-907, r4=numberText)
+			r0 number, r1 charactersRead, r5, r8 = parseInt(drop text, drop length)
+			if drop charactersRead != 4 or number != -907 {
+				return r0=1
+			}
+			drop number
+			r0 number, r1 charactersRead, r5, r8 = parseInt(r4="-x", r3=2)
+			if drop charactersRead != 0 {
+				return r0=2
+			}
+			drop number
+			return r0=0
+		}
+	`
+	output, exitStatus := runCode(t, code)
+	expected := "-1234 -9223372036854775808 0 18446744073709551615 0xbeef 0x0\n"
+	if output != expected {
+		t.Fatalf("Expected the program to print:\n%s\nbut it printed:\n%s", expected, output)
+	}
+	if exitStatus != 0 {
+		t.Fatal("Expected the program to exit with 0, but it exited with", exitStatus)
+	}
+}
+
+func TestSysCall(t *testing.T) {
+	code := `
+		fn r0 status, r2, r5, r9 = main() {
+			r0 status = ignore sysCall(r0=39)
+			r0 status = sysCall(drop status, r5=0)
+			return r0=status
+		}
+	`
+	assembly, errs := codeToAssembly(code, t.Log)
+	if printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log) {
+		t.FailNow()
+	}
+	expected := "movq $39, %rax\nsyscall\nmovq $0, %rdi\nsyscall\n"
+	if !strings.Contains(assembly, expected) {
+		t.Fatalf("Expected the assembly to contain:\n%s\nbut got:\n%s", expected, assembly)
+	}
+}
+
+func TestSyscallOverwritesRegisters(t *testing.T) {
+	code := `
+		fn r0, r2, r3, r4, r5, r9 = main() {
+			r2 count = 3
+			r0 = sysWrite(r5=1, r4="hi\n", r3=3)
+			r0 = sysExit(r5=drop count)
+		}
+	`
+	_, errs := codeToAssembly(code, t.Log)
+	if len(errs) != 1 {
+		printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log)
+		t.Fatal("Expected exactly one error, got", len(errs))
+	}
+	if errs[0].line != 4 || errs[0].column != 9 {
+		t.Fatal("Expected an error at line 4 and column 9, but it was at line", errs[0].line, "and column", errs[0].column)
+	}
+}
+
+var updateDocs = flag.Bool("update-docs", false, "Rewrite the list of built-in functions in docs.md")
+
+func TestBuiltinFunctionsAreDocumented(t *testing.T) {
+	docs, err := os.ReadFile("docs.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *updateDocs {
+		// The list starts on the line after the line that introduces it, and ends at the first empty line
+		const listIntroduction = "which are generated from the table of built-in functions in `builtins.go`:\n\n"
+		before, after, found := strings.Cut(string(docs), listIntroduction)
+		if !found {
+			t.Fatal("Could not find the list of built-in functions in docs.md")
+		}
+		_, after, _ = strings.Cut(after, "\n\n")
+		docs = []byte(before + listIntroduction + builtinFunctionsDocs() + "\n" + after)
+		err = os.WriteFile("docs.md", docs, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !strings.Contains(string(docs), builtinFunctionsDocs()) {
+		t.Fatalf("Expected docs.md to contain the list of built-in functions, which can be updated with `go generate`:\n%s", builtinFunctionsDocs())
+	}
+}
+
+func TestLoadedBuiltinFunction(t *testing.T) {
+	t.Cleanup(func() { loadedBuiltinFunctions = []builtinFunction{} })
+	err := loadBuiltinFunctions([]byte(`[{
+		"name": "addOne",
+		"docs": "returns one more than number",
+		"instructions": {"x86_64-linux": "leaq 1(%rdi), %rax"},
+		"arguments": [{"register": 5, "name": "number", "type": "i64"}],
+		"returnValues": [{"register": 0, "name": "result", "type": "i64"}]
+	}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = loadBuiltinFunctions([]byte(`[{"name": "subtractOne", "instructions": {"arm64-linux": ""}}]`))
+	if err == nil {
+		t.Fatal("Expected an error for a built-in function with instructions for a target that does not exist")
+	}
+	code := `
+		fn r0 status, r5 = main() {
+			r0 status = addOne(r5=41)
+			return r0=status
+		}
+	`
+	_, exitStatus := runCode(t, code)
+	if exitStatus != 42 {
+		t.Fatal("Expected the program to exit with 42, but it exited with", exitStatus)
+	}
+}
+
+func TestBuiltinFunctionMissingRequiredArgument(t *testing.T) {
+	code := `
+		fn r0, r2, r9 = main() {
+			r0 = sysCall()
+		}
+	`
+	_, errs := codeToAssembly(code, t.Log)
+	if len(errs) != 1 {
+		printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log)
+		t.Fatal("Expected exactly one error, got", len(errs))
+	}
+	if errs[0].msg.Error() != "`sysCall` has to be given `number` in r0" {
+		t.Fatal("Unexpected error:", errs[0].msg)
+	}
+}
+
+func TestUncheckedSyscallResult(t *testing.T) {
+	code := `
+		fn r0, r2, r3, r4, r5, r9 = main() {
+			r0 written = sysWrite(r5=1, r4="hi\n", r3=3)
+			written = sysWrite(r5=1, r4="hi\n", r3=3)
+			if written < 0 {
+				written = sysExit(r5=1)
+			}
+		}
+	`
+	_, errs := codeToAssembly(code, t.Log)
+	if len(errs) != 1 {
+		printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log)
+		t.Fatal("Expected exactly one error, got", len(errs))
+	}
+	if errs[0].line != 3 || errs[0].column != 17 {
+		t.Fatal("Expected an error at line 3 and column 17, but it was at line", errs[0].line, "and column", errs[0].column)
+	}
+}
+
+func TestCheckedSyscallResult(t *testing.T) {
+	code := `
+		buffer input[1]
+
+		fn r0 status, r2, r3, r4, r5, r9 = main() {
+			r0 = ignore sysWrite(r5=1, r4="hi\n", r3=3)
+			r0 written = sysWrite(r5=1, r4="hi\n", r3=3)
+			while written < 3 {
+				written = sysExit(r5=1)
+			}
+			drop written
+			# The result that is read at the end of the loop body is checked by the loop condition
+			r0 bytesRead = sysRead(r5=0, r4=input, r3=1)
+			while bytesRead > 0 {
+				bytesRead = sysRead(r5=0, r4=input, r3=1)
+			}
+			drop bytesRead
+			r0 status = sysGetpid()
+			status = sysWrite(r5=1, r4="hi\n", r3=3)
+		}
+	`
+	_, errs := codeToAssembly(code, t.Log)
+	if printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log) {
+		t.FailNow()
+	}
+}
+
+func TestDefer(t *testing.T) {
+	code := `
+		import format
+
+		fn r0 status, r1, r2, r3, r4, r5, r9 = main() {
+			defer {
+				r0, r2, r5, r9 = print(r4="end\n", r3=4)
+			}
+			r1 counter = 0
+			while counter < 5 {
+				counter++
+				defer {
+					r0, r2, r5, r9 = print(r4=".", r3=1)
+				}
+				if counter == 2 {
+					continue
+				} elif counter == 4 {
+					break
+				}
+				r0, r2, r5, r9 = print(r4="x", r3=1)
+			}
+			drop counter
+			return r0=0
+		}
+	`
+	output, exitStatus := runCode(t, code)
+	expected := "x..x..end\n"
+	if output != expected {
+		t.Fatalf("Expected the program to print:\n%s\nbut it printed:\n%s", expected, output)
+	}
+	if exitStatus != 0 {
+		t.Fatal("Expected the program to exit with 0, but it exited with", exitStatus)
+	}
+}
+
+func TestDeferredCodeUsesDroppedVariable(t *testing.T) {
+	code := `
+		fn r0, r2, r5, r9 = main() {
+			r5 file = 3
+			defer {
+				r0 = ignore sysClose(file)
+			}
+			drop file
+		}
+	`
+	_, errs := codeToAssembly(code, t.Log)
+	if len(errs) != 1 {
+		printErrorsInCode("test code", strings.Split(code, "\n"), errs, t.Log)
+		t.Fatal("Expected exactly one error, got", len(errs))
+	}
+	if errs[0].line != 5 || errs[0].column != 26 {
+		t.Fatal("Expected an error at line 5 and column 26, but it was at line", errs[0].line, "and column", errs[0].column)
+	}
+}
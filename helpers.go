@@ -1,8 +1,10 @@
 package main
 
 import (
+	"cmp"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 	//"github.com/davecgh/go-spew/spew"
@@ -42,7 +44,9 @@ func checkRegisterListsAreTheSame(expectedRegisters []Register, givenRegisters [
 		}
 	}
 	for i := range expectedRegisters {
-		if expectedRegisters[i] != givenRegisters[i].register {
+		// Any register can be given where `any` is expected
+		if expectedRegisters[i] != AnyRegister &&
+			expectedRegisters[i] != givenRegisters[i].register {
 			return codeParsingError{
 				textLocation: givenRegisters[i].location,
 				msg: errors.New("On register number " + fmt.Sprint(i+1) + ": expected the register r" +
@@ -79,17 +83,28 @@ func codeToAssembly(code string, printLineFunc func(...any)) (string, []codePars
 	if err.msg != nil {
 		return "", []codeParsingError{err}
 	}
+	AST, imports, err := addImportedModules(AST)
+	if err.msg != nil {
+		return "", []codeParsingError{err}
+	}
 
 	// TODO: Figure out the best method to print the AST type
 	// spew.Dump(AST)
 
 	printLineFunc("Compiling abstract syntax tree into assembly...")
-	return compileAssembly(AST)
+	assembly, errs := compileAssembly(AST)
+	for index := range errs {
+		// A module can be imported by another module, so this is repeated until the error is in the
+		// file that is being compiled
+		for errs[index].module != "" {
+			errs[index] = errorInModule(imports[errs[index].module], errs[index])
+		}
+	}
+	return assembly, errs
 }
 
-// Prints each error in `errors` with the 10 lines of code around where the
-// error occurred. Assumes that `errors` is in order of their `location.line`
-// property.
+// Prints each error and warning in `errors` with the 10 lines of code around where
+// it occurred. Returns true if any of `errors` are not warnings.
 func printErrorsInCode(
 	fileName string,
 	fileLines []string,
@@ -99,7 +114,18 @@ func printErrorsInCode(
 	if len(errors) == 0 {
 		return false
 	}
-	printLineFunc(ansiBold, "===============", len(errors), "errors encountered in", fileName, "===============", ansiReset)
+	errors = slices.Clone(errors)
+	slices.SortStableFunc(errors, func(a codeParsingError, b codeParsingError) int {
+		return cmp.Compare(a.line, b.line)
+	})
+	numberOfWarnings := 0
+	for _, err := range errors {
+		if err.isWarning {
+			numberOfWarnings++
+		}
+	}
+	printLineFunc(ansiBold, "===============", len(errors)-numberOfWarnings, "errors and", numberOfWarnings,
+		"warnings encountered in", fileName, "===============", ansiReset)
 	charactersNeededForLineNumber := len(fmt.Sprint(errors[len(errors)-1].textLocation.line))
 	currentErrorIndex := 0
 	shouldContinue := true
@@ -129,7 +155,11 @@ func printErrorsInCode(
 						print(" ")
 					}
 				}
-				printLineFunc("^ " + ansiBold + errors[currentErrorIndex].msg.Error() + ansiReset)
+				prefix := "^ "
+				if errors[currentErrorIndex].isWarning {
+					prefix += "Warning: "
+				}
+				printLineFunc(prefix + ansiBold + errors[currentErrorIndex].msg.Error() + ansiReset)
 				if currentErrorIndex >= len(errors)-1 {
 					shouldContinue = false
 					break
@@ -140,7 +170,7 @@ func printErrorsInCode(
 			lineNumber++
 		}
 	}
-	return true
+	return numberOfWarnings != len(errors)
 }
 
 func printTableSymbolsRow(
@@ -201,6 +231,10 @@ type textLocation struct {
 	// Line and column indexing start at 1
 	line   int
 	column int
+
+	// The module of the standard library that the location is in, or "" if it is in the file that is
+	// being compiled
+	module string
 }
 
 func (location textLocation) location() textLocation { return location }
@@ -8,7 +8,9 @@ package main
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 ///////////////////////
@@ -79,13 +81,13 @@ const (
 	Unknown keywordType = iota
 	//                // keyword.contents             //
 	// -------------- // ---------------------------- //
-	Name              // myFuncName1, myVarName2      //
-	RegisterKeyword   // b0, b1, b2..., s0, s1, s2... //
+	Name              // myFuncName1, point.x         //
+	RegisterKeyword   // r0, r1, r2..., any           //
 	StringValue       // "Foo", "Bar"                 //
 	CharValue         // 'a', '\n'                    //
 	BoolValue         // true, false                  //
-	PositiveInteger   // 4, 23                        //
-	NegativeInteger   // -4, -5                       //
+	PositiveInteger   // 4, 0xff, 0b101, 1_000        //
+	NegativeInteger   // -4, -0x5                     //
 	Decimal           // 2.1, 5.8                     //
 	IncreaseNesting   // (, {, [                      //
 	DecreaseNesting   // ), }, ]                      //
@@ -99,18 +101,32 @@ const (
 	MinusEquals       // -=                           //
 	MultiplyEquals    // *=                           //
 	DivideEquals      // /=                           //
+	AndEquals         // &=                           //
+	OrEquals          // |=                           //
+	XorEquals         // xor=                         //
+	ShiftLeftEquals   // <<=                          //
+	ShiftRightEquals  // >>=, >>>=                    //
+	Not               // not                          //
+	Ignore            // ignore                       //
 	WhileLoop         // while                        //
 	BreakStatement    // break                        //
 	ContinueStatement // continue                     //
+	Defer             // defer                        //
+	NameWithColon     // outer:, x:, point:           //
 	IfStatement       // if                           //
 	ElifStatement     // elif                         //
 	ElseStatement     // else                         //
 	ComparisonSyntax  // ==, !=, >, <, >=, <=         //
+	BinaryOperator    // +, -, *, /, %, &, |, <<, >>  //
 	And               // and                          //
 	Or                // or                           //
 	ListSyntax        // ,                            //
 	Import            // import                       //
-	Dereference       // ^                            //
+	Constant          // const                        //
+	GlobalVariable    // var                          //
+	Struct            // struct                       //
+	Enum              // enum                         //
+	Dereference       // ^, ^u8, ^i32                 //
 	Comment           // # My comment 2               //
 	Newline           // \n                           //
 )
@@ -189,6 +205,9 @@ func printKeywords(keywords []keyword) {
 type codeParsingError struct {
 	msg error
 	textLocation
+	// If this is true, then the code can still be compiled, but it might not do what the
+	// programmer expects
+	isWarning bool
 }
 
 ////////////////////////
@@ -219,12 +238,137 @@ func isNotVariableCharacter(character byte) bool {
 	return true
 }
 
+func isHexadecimalDigit(character byte) bool {
+	return ('0' <= character && character <= '9') ||
+		('a' <= character && character <= 'f') ||
+		('A' <= character && character <= 'F')
+}
+
+// Decodes the escape sequence at the start of `text`, which must start with a
+// `\`. Returns the decoded bytes, and the number of bytes in `text` that the
+// escape sequence uses.
+func decodeEscapeSequence(text string) (string, int, error) {
+	assert(eq(text[0], '\\'))
+	if len(text) < 2 {
+		return "", 1, errors.New("Unexpected end of text while parsing escape sequence")
+	}
+	switch text[1] {
+	case 'n':
+		return "\n", 2, nil
+	case 't':
+		return "\t", 2, nil
+	case 'r':
+		return "\r", 2, nil
+	case '0':
+		return "\x00", 2, nil
+	case '\\', '"', '\'':
+		return string(text[1]), 2, nil
+	case 'x':
+		if len(text) < 4 || !isHexadecimalDigit(text[2]) || !isHexadecimalDigit(text[3]) {
+			return "", 2, errors.New("Expected 2 hexadecimal digits after `\\x`")
+		}
+		value, err := strconv.ParseUint(text[2:4], 16, 8)
+		assert(eq(err, nil))
+		return string([]byte{byte(value)}), 4, nil
+	case 'u':
+		end := strings.IndexByte(text, '}')
+		if len(text) < 3 || text[2] != '{' || end == -1 {
+			return "", 2, errors.New("Expected `\\u` to be followed by a unicode code point in the format `{...}`")
+		}
+		codePoint, err := strconv.ParseUint(text[3:end], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(codePoint)) {
+			return "", end + 1, errors.New("`" + text[3:end] + "` is not a valid unicode code point in hexadecimal")
+		}
+		return string(rune(codePoint)), end + 1, nil
+	default:
+		return "", 2, errors.New(
+			"Unknown escape sequence `\\" + string(text[1]) +
+				"`. Known escape sequences are \\n, \\t, \\r, \\0, \\\\, \\\", \\', \\xNN, and \\u{...}",
+		)
+	}
+}
+
+// Decodes every escape sequence in the contents of a string or character value.
+// If there is an invalid escape sequence, then an error is returned along with
+// the index of the escape sequence in `contents`.
+func decodeEscapeSequences(contents string) (string, int, error) {
+	decoded := ""
+	for index := 0; index < len(contents); {
+		if contents[index] != '\\' {
+			decoded += contents[index : index+1]
+			index++
+			continue
+		}
+		decodedEscapeSequence, length, err := decodeEscapeSequence(contents[index:])
+		if err != nil {
+			return "", index, err
+		}
+		decoded += decodedEscapeSequence
+		index += length
+	}
+	return decoded, 0, nil
+}
+
+// Lexes a string or character value that starts with the quote at
+// `text.index`, and ends with the next quote of the same type that is not a
+// part of an escape sequence. Returns the text of the value including the
+// quotes.
+func lexQuotedValue(text *textAndPosition, parsingErrors *[]codeParsingError) string {
+	quote := text.text[text.index]
+	start := text.index
+	for true {
+		if text.moveForward() || text.text[text.index] == '\n' {
+			add(parsingErrors, codeParsingError{
+				msg:          errors.New("Unexpected end of line, expecting `" + string(quote) + "` to end the value"),
+				textLocation: text.location,
+			})
+			return text.text[start:text.index]
+		}
+		if text.text[text.index] == '\\' {
+			text.moveForward()
+			continue
+		}
+		if text.text[text.index] == quote {
+			end := text.index + 1
+			text.moveForward()
+			return text.text[start:end]
+		}
+	}
+	panic("Unreachable")
+}
+
+// Checks that the escape sequences in a string or character value keyword are
+// valid, and returns the decoded contents of the keyword without the quotes.
+func decodeQuotedValue(contents string, location textLocation) (string, []codeParsingError) {
+	if len(contents) < 2 || contents[len(contents)-1] != contents[0] {
+		// `lexQuotedValue` has already added an error for the value not being ended
+		return "", nil
+	}
+	decoded, index, err := decodeEscapeSequences(contents[1 : len(contents)-1])
+	if err != nil {
+		return "", []codeParsingError{{
+			msg:          err,
+			textLocation: textLocation{line: location.line, column: location.column + 1 + index},
+		}}
+	}
+	return decoded, nil
+}
+
 ///////////////
 // MAIN CODE //
 ///////////////
 
-// The returned bool is true if the number is a decimal, and false otherwise
+// The returned bool is true if the number is a decimal, and false otherwise.
+// Numbers can start with `0x`, `0b`, or `0o` for hexadecimal, binary, or octal,
+// and the digits of a number can be separated with `_`.
 func positiveNumberToKeyword(text *textAndPosition) (bool, string) {
+	// Parse a number with a base prefix, including any invalid digits so that
+	// the parser can give an error for them
+	if text.text[text.index] == '0' && text.index+1 < len(text.text) &&
+		strings.ContainsRune("xXbBoO", rune(text.text[text.index+1])) {
+		return false, text.findUntilWithIteratedString(isNotVariableCharacter)
+	}
+
 	// Parse any digits (and `_`) into keywordContents
 	keywordContents := text.findUntilWithIteratedString(isNotNumber)
 
@@ -241,6 +385,18 @@ func positiveNumberToKeyword(text *textAndPosition) (bool, string) {
 	return true, keywordContents + text.findUntilWithIteratedString(isNotNumber)
 }
 
+// Returns true if `keyword` can be the last keyword of a value, in which case a `-` after it is a
+// subtraction rather then the start of a negative number, for example in `length-1`
+func keywordEndsValue(keyword keyword) bool {
+	switch keyword.keywordType {
+	case Name, PositiveInteger, NegativeInteger, Decimal, StringValue, CharValue, BoolValue:
+		return true
+	case DecreaseNesting:
+		return keyword.contents == ")" || keyword.contents == "]"
+	}
+	return false
+}
+
 func lexCode(code string) ([]keyword, []codeParsingError) {
 	text := textAndPosition{
 		text:  code,
@@ -287,63 +443,35 @@ func lexCode(code string) ([]keyword, []codeParsingError) {
 
 		case '\'':
 			keywordType = CharValue
-			keywordContents = "'"
-			if text.moveForward() {
-				add(&parsingErrors, codeParsingError{
-					msg:          errors.New("Unexpected end of text while parsing character value"),
-					textLocation: text.location,
-				})
-			}
-			if text.text[text.index] == '\\' {
-				keywordContents += "\\"
-				if text.moveForward() {
-					add(&parsingErrors, codeParsingError{
-						msg:          errors.New("Unexpected end of text while parsing character value"),
-						textLocation: text.location,
-					})
-				}
-			}
-			keywordContents += string(text.text[text.index]) + "'"
-			if text.moveForward() {
-				add(&parsingErrors, codeParsingError{
-					msg:          errors.New("Unexpected end of text while parsing character value"),
-					textLocation: text.location,
-				})
-			}
-			if text.text[text.index] != '\'' {
+			keywordContents = lexQuotedValue(&text, &parsingErrors)
+			decoded, errs := decodeQuotedValue(keywordContents, keywordPosition)
+			parsingErrors = append(parsingErrors, errs...)
+			if len(errs) == 0 && (len(decoded) < 1 || len(decoded) > 8) {
 				add(&parsingErrors, codeParsingError{
-					msg:          errors.New("Expected `'' to end character value, got `" + string(text.text[text.index]) + "`"),
-					textLocation: text.location,
+					msg:          errors.New("A character value must be between 1 and 8 bytes long so that it fits in 64 bits, got " + fmt.Sprint(len(decoded)) + " bytes"),
+					textLocation: keywordPosition,
 				})
 			}
-			text.moveForward()
 
 		case '"':
 			keywordType = StringValue
-			keywordContents = "\""
-			text.moveForward()
-			keywordContents += text.findUntilWithIteratedString(func(character byte) bool {
-				if character == '"' {
-					return true
-				}
-				return false
-			})
-			keywordContents += "\""
-			text.moveForward()
+			keywordContents = lexQuotedValue(&text, &parsingErrors)
+			_, errs := decodeQuotedValue(keywordContents, keywordPosition)
+			parsingErrors = append(parsingErrors, errs...)
 
 		case ',', ':', '=', '|', '<', '>', '&', '+', '-', '*', '/', '.', '%', '!', '^':
-			// Get a list of consecutively used syntax symbols. We cannot use
-			// `findUntilWithIteratedString` since that would add the ignorable
-			// whitespace to the string.
+			// Get a list of consecutively used syntax symbols. Whitespace and
+			// negative numbers end the list, so that both `x = -4` and `r0=-4` are
+			// lexed as `=` followed by `-4`.
 			keywordContents = string(text.text[text.index])
 			text.moveForward()
-			text.findUntil(func(character byte) bool {
-				if !isNotIgnorableWhitespace(character) {
-					return false
+			keywordContents += text.findUntilWithIteratedString(func(character byte) bool {
+				if character == '-' && text.index+1 < len(text.text) &&
+					'0' <= text.text[text.index+1] && text.text[text.index+1] <= '9' {
+					return true
 				}
 				switch character {
 				case ':', '=', '|', '<', '>', '&', '+', '-', '*', '/', '.', '%':
-					keywordContents += string(character)
 					return false
 				}
 				return true
@@ -366,18 +494,33 @@ func lexCode(code string) ([]keyword, []codeParsingError) {
 				keywordType = MultiplyEquals
 			case "/=":
 				keywordType = DivideEquals
+			case "&=":
+				keywordType = AndEquals
+			case "|=":
+				keywordType = OrEquals
+			case "<<=":
+				keywordType = ShiftLeftEquals
+			case ">>=", ">>>=":
+				keywordType = ShiftRightEquals
 			case "==", "!=", "<=", ">=", "<", ">":
 				keywordType = ComparisonSyntax
+			case "+", "*", "/", "%", "&", "|", "<<", ">>", ">>>":
+				keywordType = BinaryOperator
 			case "^":
 				keywordType = Dereference
-			case "-": // The keyword is a negative number
-				text.moveForward()
-				if text.text[text.index] < '0' || text.text[text.index] > '9' {
-					add(&parsingErrors, codeParsingError{
-						msg:          errors.New("After `-`, expecting a number"),
-						textLocation: keywordPosition,
-					})
-					continue
+				// The size of the memory to use can be written directly after `^`, for example `^u8`
+				textBeforeSize := text
+				size := text.findUntilWithIteratedString(isNotVariableCharacter)
+				if _, isSize := memoryAccessSizes[size]; isSize {
+					keywordContents += size
+				} else {
+					text = textBeforeSize
+				}
+			case "-": // The keyword is either a negative number or a subtraction
+				if text.text[text.index] < '0' || text.text[text.index] > '9' ||
+					len(keywords) > 0 && keywordEndsValue(keywords[len(keywords)-1]) {
+					keywordType = BinaryOperator
+					break
 				}
 				hasDecimal := false
 				hasDecimal, keywordContents = positiveNumberToKeyword(&text)
@@ -421,32 +564,55 @@ func lexCode(code string) ([]keyword, []codeParsingError) {
 				keywordType = BreakStatement
 			case "continue":
 				keywordType = ContinueStatement
+			case "defer":
+				keywordType = Defer
 			case "true", "false":
 				keywordType = BoolValue
 			case "r0", "r1", "r2", "r3", "r4", "r5", "r6", "r7",
-				"r8", "r9", "r10", "r11", "r12", "r13", "r14", "r15":
+				"r8", "r9", "r10", "r11", "r12", "r13", "r14", "r15", "any":
 				keywordType = RegisterKeyword
 			case "return":
 				keywordType = FunctionReturn
 			case "import":
 				keywordType = Import
+			case "const":
+				keywordType = Constant
+			case "var":
+				keywordType = GlobalVariable
+			case "struct":
+				keywordType = Struct
+			case "enum":
+				keywordType = Enum
 			case "and":
 				keywordType = And
 			case "or":
 				keywordType = Or
+			case "not":
+				keywordType = Not
+			case "ignore":
+				keywordType = Ignore
+			case "xor":
+				// `^` cannot be used for xor, since `^` is used for dereferencing
+				keywordType = BinaryOperator
+				if text.index < len(text.text) && text.text[text.index] == '=' {
+					keywordType = XorEquals
+					keywordContents += "="
+					text.moveForward()
+				}
 			default:
+				if text.text[text.index] == ':' {
+					keywordType = NameWithColon
+					keywordContents += ":"
+					text.moveForward()
+					break
+				}
 				keywordType = Name
 				text.findUntil(isNotIgnorableWhitespace)
 				if text.text[text.index] == '.' {
 					keywordContents += "."
 					text.index++
 					text.findUntil(isNotIgnorableWhitespace)
-					keywordContents += text.findUntilWithIteratedString(func(character byte) bool {
-						if ('0' <= character && character <= '9') || character == '_' {
-							return false
-						}
-						return true
-					})
+					keywordContents += text.findUntilWithIteratedString(isNotVariableCharacter)
 				}
 			}
 
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -17,6 +18,17 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Built-in functions can be added for the code in the current directory in builtins.json
+	builtinsFile, err := os.ReadFile("builtins.json")
+	if err == nil {
+		fmt.Println("Loading built-in functions from builtins.json...")
+		err = loadBuiltinFunctions(builtinsFile)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		println(err.Error())
+		os.Exit(1)
+	}
+
 	assembly, errs := codeToAssembly(string(rawText), passablePrintln)
 	if printErrorsInCode(fileName, strings.Split(string(rawText), "\n"), errs, passablePrintln) {
 		os.Exit(1)
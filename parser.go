@@ -3,8 +3,10 @@ package main
 import (
 	"errors"
 	"fmt"
+	"math"
 	"reflect"
 	"strconv"
+	"strings"
 )
 
 // Parser.go
@@ -30,36 +32,39 @@ func nextNonEmpty(keywords *listIterator[keyword], errorMsg string) codeParsingE
 	panic("Unreachable")
 }
 
+// Splits a condition by each keyword of type `splitType` that is not in brackets
 func splitCondition(keywords []keyword, splitType keywordType) ([][]keyword, codeParsingError) {
 	lastSplitIndex := -1
-	nesting := 0
+	unclosedBrackets := []keyword{}
 	returnValue := [][]keyword{}
 	for index, item := range keywords {
 		switch item.keywordType {
 		case IncreaseNesting:
-			if item.contents != "(" {
+			if item.contents != "(" && item.contents != "[" {
 				return [][]keyword{}, codeParsingError{
-					msg:          errors.New("In conditions, keyword of type IncreaseNesting must have contents (, got a keyword with contents " + item.contents),
+					msg:          errors.New("In conditions, keyword of type IncreaseNesting must have contents ( or [, got a keyword with contents " + item.contents),
 					textLocation: item.location,
 				}
 			}
-			nesting++
+			add(&unclosedBrackets, item)
 		case DecreaseNesting:
-			if item.contents != ")" {
+			openingBracket, isValid := map[string]string{")": "(", "]": "["}[item.contents]
+			if !isValid {
 				return [][]keyword{}, codeParsingError{
-					msg:          errors.New("In conditions, keyword of type DecreaseNesting must have contents ), got a keyword with contents " + item.contents),
+					msg:          errors.New("In conditions, keyword of type DecreaseNesting must have contents ) or ], got a keyword with contents " + item.contents),
 					textLocation: item.location,
 				}
 			}
-			nesting--
-			if nesting < 0 {
+			if len(unclosedBrackets) == 0 || unclosedBrackets[len(unclosedBrackets)-1].contents != openingBracket {
 				return [][]keyword{}, codeParsingError{
-					msg:          errors.New("Unexpected ), without a ( before it to match"),
+					msg: errors.New("Unexpected " + item.contents + ", without a " + openingBracket + " before it to match in the condition that starts at line " +
+						fmt.Sprint(keywords[0].location.line) + " and column " + fmt.Sprint(keywords[0].location.column)),
 					textLocation: item.location,
 				}
 			}
+			unclosedBrackets = unclosedBrackets[:len(unclosedBrackets)-1]
 		case splitType:
-			if nesting > 0 {
+			if len(unclosedBrackets) > 0 {
 				continue
 			}
 			if index == 0 || index == len(keywords)-1 {
@@ -72,20 +77,46 @@ func splitCondition(keywords []keyword, splitType keywordType) ([][]keyword, cod
 			lastSplitIndex = index
 		}
 	}
-	if nesting > 0 {
+	if len(unclosedBrackets) > 0 {
+		lastKeyword := keywords[len(keywords)-1]
 		return [][]keyword{}, codeParsingError{
-			msg:          errors.New("In condition, there is " + fmt.Sprint(nesting) + " unclosed ("),
-			textLocation: keywords[0].location,
+			msg: errors.New("This " + unclosedBrackets[len(unclosedBrackets)-1].contents + " is not closed before the end of the condition at line " +
+				fmt.Sprint(lastKeyword.location.line) + " and column " + fmt.Sprint(lastKeyword.location.column)),
+			textLocation: unclosedBrackets[len(unclosedBrackets)-1].location,
 		}
 	}
 	add(&returnValue, keywords[lastSplitIndex+1:])
 	return returnValue, codeParsingError{}
 }
 
+// Returns the index of the `)` that closes the `(` at the start of `keywords`, or -1 if there is
+// not one
+func indexOfClosingBracket(keywords []keyword) int {
+	assert(eq(keywords[0].contents, "("))
+	nesting := 0
+	for index, item := range keywords {
+		switch item.contents {
+		case "(":
+			nesting++
+		case ")":
+			nesting--
+			if nesting == 0 {
+				return index
+			}
+		}
+	}
+	return -1
+}
+
 func parseCondition(keywords []keyword) (condition, codeParsingError) {
-	// Handle outside brackets
-	if keywords[0].contents == "(" && keywords[len(keywords)-1].contents == ")" {
-		return parseCondition(keywords[1 : len(keywords)-1])
+	// Handle conditions with `or` in them. These are split before conditions with `and` in them so
+	// that `and` is calculated before `or`.
+	orClauses, err := splitCondition(keywords, Or)
+	if err.msg != nil {
+		return nil, err
+	}
+	if len(orClauses) > 1 {
+		return parseConditionClauses(orClauses, false)
 	}
 
 	// Handle conditions with `and` in them
@@ -97,13 +128,31 @@ func parseCondition(keywords []keyword) (condition, codeParsingError) {
 		return parseConditionClauses(andClauses, true)
 	}
 
-	// Handle conditions with `or` in them
-	orClauses, err := splitCondition(keywords, Or)
-	if err.msg != nil {
-		return nil, err
+	// Handle `not`
+	if keywords[0].keywordType == Not {
+		if len(keywords) == 1 {
+			return nil, codeParsingError{
+				msg:          errors.New("Expected a condition after `not`"),
+				textLocation: keywords[0].location,
+			}
+		}
+		negatedCondition, err := parseCondition(keywords[1:])
+		if err.msg != nil {
+			return nil, err
+		}
+		return notCondition{textLocation: keywords[0].location, condition: negatedCondition},
+			codeParsingError{}
 	}
-	if len(orClauses) > 1 {
-		return parseConditionClauses(orClauses, false)
+
+	// Handle outside brackets
+	if keywords[0].contents == "(" && indexOfClosingBracket(keywords) == len(keywords)-1 {
+		if len(keywords) == 2 {
+			return nil, codeParsingError{
+				msg:          errors.New("Expected a condition in between `(` and `)`"),
+				textLocation: keywords[0].location,
+			}
+		}
+		return parseCondition(keywords[1 : len(keywords)-1])
 	}
 
 	// Handle if there is only 1 keyword
@@ -128,6 +177,9 @@ func parseCondition(keywords []keyword) (condition, codeParsingError) {
 
 // Converts a string to a register
 func stringToRegister(in string) Register {
+	if in == "any" {
+		return AnyRegister
+	}
 	assert(eq(in[0], 'r'))
 	register, err := strconv.Atoi(in[1:])
 	assert(eq(err, nil))
@@ -195,7 +247,8 @@ func parseFunctionArguments(keywords *listIterator[keyword]) ([]registerAndRawVa
 }
 
 // After a succsesful execution of this function, `keywords.get()` should return the keyword at the
-// end of the variable value. This keyword should always be of type Name.
+// end of the variable value. This keyword should either be of type Name, or be the `]` or `)` at the
+// end of a memory address.
 func parseVariableValue(keywords *listIterator[keyword]) (variableValue, codeParsingError) {
 	out := variableValue{
 		textLocation:             keywords.get().location,
@@ -205,7 +258,44 @@ func parseVariableValue(keywords *listIterator[keyword]) (variableValue, codePar
 	for true {
 		switch keywords.get().keywordType {
 		case Dereference:
+			// The size of the first `^` is the size of the memory that is read, and every other `^`
+			// reads a pointer
+			size := keywords.get().contents[1:]
+			if out.pointerDereferenceLayers == 0 {
+				out.dereferenceSize = memoryAccessSize{bits: 64}
+				if size != "" {
+					out.dereferenceSize = memoryAccessSizes[size]
+				}
+			} else if size != "" {
+				return variableValue{}, codeParsingError{
+					msg:          errors.New("Only the first `^` of a value can have a size, since every other `^` reads a pointer"),
+					textLocation: keywords.get().location,
+				}
+			}
 			out.pointerDereferenceLayers++
+
+			// Handle a memory address like `^(pointer + offset)`
+			if keywords.currentIndex+1 < len(keywords.list) &&
+				keywords.list[keywords.currentIndex+1].contents == "(" {
+				keywords.next()
+				err := nextNonEmpty(keywords, "After `(`, unexpected end of keywords")
+				if err.msg != nil {
+					return variableValue{}, err
+				}
+				if keywords.get().keywordType != Name {
+					return variableValue{}, codeParsingError{
+						msg:          errors.New("Expected a memory address in brackets to start with the name of a pointer, got `" + keywords.get().contents + "`"),
+						textLocation: keywords.get().location,
+					}
+				}
+				out.name = keywords.get().contents
+				err = nextNonEmpty(keywords, "After the name of a pointer, unexpected end of keywords")
+				if err.msg != nil {
+					return variableValue{}, err
+				}
+				out.offset, err = parseMemoryOffset(keywords, ")", true)
+				return out, err
+			}
 		case DropVariable:
 			if out.variableIsDropped {
 				return variableValue{}, codeParsingError{
@@ -215,8 +305,60 @@ func parseVariableValue(keywords *listIterator[keyword]) (variableValue, codePar
 			} else {
 				out.variableIsDropped = true
 			}
+		case NameWithColon:
+			// Parse the struct that a variable points to or the enum that it stores, like
+			// `point: Point`
+			if out.pointerDereferenceLayers > 0 || out.variableIsDropped {
+				return variableValue{}, codeParsingError{
+					msg:          errors.New("A variable that is given a struct or enum cannot be dereferenced or dropped"),
+					textLocation: keywords.get().location,
+				}
+			}
+			out.name = keywords.get().contents[:len(keywords.get().contents)-1]
+			err := nextNonEmpty(keywords, "After `"+keywords.get().contents+"`, unexpected end of keywords")
+			if err.msg != nil {
+				return variableValue{}, err
+			}
+			if keywords.get().keywordType != Name {
+				return variableValue{}, codeParsingError{
+					msg:          errors.New("Expected the name of a struct or enum after `" + out.name + ":`, got `" + keywords.get().contents + "`"),
+					textLocation: keywords.get().location,
+				}
+			}
+			out.typeName = keywords.get().contents
+			return out, codeParsingError{}
 		case Name:
 			out.name = keywords.get().contents
+
+			// Handle a struct field like `point.x`
+			if name, field, isField := strings.Cut(out.name, "."); isField {
+				if out.pointerDereferenceLayers > 0 || strings.Contains(field, ".") {
+					return variableValue{}, codeParsingError{
+						msg:          errors.New("A struct field cannot be dereferenced, since it is already read from memory"),
+						textLocation: keywords.get().location,
+					}
+				}
+				out.name = name
+				out.field = field
+				out.pointerDereferenceLayers = 1
+				return out, codeParsingError{}
+			}
+
+			// Handle a memory address like `list[index]`, which is the same as `^(list + index)`
+			if keywords.currentIndex+1 < len(keywords.list) &&
+				keywords.list[keywords.currentIndex+1].contents == "[" {
+				keywords.next()
+				err := nextNonEmpty(keywords, "After `[`, unexpected end of keywords")
+				if err.msg != nil {
+					return variableValue{}, err
+				}
+				if out.pointerDereferenceLayers == 0 {
+					out.dereferenceSize = memoryAccessSize{bits: 64}
+				}
+				out.pointerDereferenceLayers++
+				out.offset, err = parseMemoryOffset(keywords, "]", false)
+				return out, err
+			}
 			return out, codeParsingError{}
 		default:
 			return variableValue{}, codeParsingError{
@@ -232,44 +374,285 @@ func parseVariableValue(keywords *listIterator[keyword]) (variableValue, codePar
 	panic("Unreachable")
 }
 
+// Parses the part of a memory address that is added to a pointer, for example `index * 8 + 16` in
+// `list[index * 8 + 16]`. If `startsWithOperator` is true, then the first keyword should either be
+// `+`, `-`, or `closingBracket`, otherwise it should be the first index or number. After a
+// succsesful execution of this function, `keywords.get()` returns `closingBracket`.
+func parseMemoryOffset(
+	keywords *listIterator[keyword],
+	closingBracket string,
+	startsWithOperator bool,
+) (memoryOffset, codeParsingError) {
+	out := memoryOffset{}
+	expectOperator := startsWithOperator
+	isSubtracted := false
+	for true {
+		// Parse the `+` or `-` before a number or an index
+		if expectOperator {
+			switch {
+			case keywords.get().contents == closingBracket:
+				return out, codeParsingError{}
+			case keywords.get().contents == "+" || keywords.get().contents == "-":
+				isSubtracted = keywords.get().contents == "-"
+				err := nextNonEmpty(keywords, "After `"+keywords.get().contents+"`, unexpected end of keywords")
+				if err.msg != nil {
+					return memoryOffset{}, err
+				}
+			case keywords.get().keywordType == NegativeInteger:
+				// A negative number like `-4` in `list[index-4]` is lexed without a separate `-`
+				isSubtracted = false
+			default:
+				return memoryOffset{}, codeParsingError{
+					msg:          errors.New("Expected `+`, `-`, or `" + closingBracket + "` in a memory address, got `" + keywords.get().contents + "`"),
+					textLocation: keywords.get().location,
+				}
+			}
+		}
+
+		// Parse a number like `16`, or an index like `index`, `index * 8`, or `8 * index`
+		var number *keyword
+		var index *keyword
+		switch keywords.get().keywordType {
+		case PositiveInteger, NegativeInteger:
+			number = keywords.get()
+		case Name:
+			index = keywords.get()
+		default:
+			return memoryOffset{}, codeParsingError{
+				msg:          errors.New("Expected a variable or a number in a memory address, got `" + keywords.get().contents + "`"),
+				textLocation: keywords.get().location,
+			}
+		}
+		if keywords.currentIndex+1 < len(keywords.list) &&
+			keywords.list[keywords.currentIndex+1].contents == "*" {
+			keywords.next()
+			err := nextNonEmpty(keywords, "After `*`, unexpected end of keywords")
+			if err.msg != nil {
+				return memoryOffset{}, err
+			}
+			switch {
+			case number != nil && keywords.get().keywordType == Name:
+				index = keywords.get()
+			case index != nil && keywords.get().keywordType == PositiveInteger:
+				number = keywords.get()
+			default:
+				return memoryOffset{}, codeParsingError{
+					msg:          errors.New("In a memory address, `*` can only be used to multiply a variable by a number"),
+					textLocation: keywords.get().location,
+				}
+			}
+		}
+		value := int64(1)
+		if number != nil {
+			var err error
+			value, err = strconv.ParseInt(number.contents, 0, 64)
+			if err != nil {
+				return memoryOffset{}, numberParsingError(*number, err)
+			}
+		}
+		if index == nil {
+			if isSubtracted {
+				value = -value
+			}
+			out.displacement += value
+			if out.displacement < math.MinInt32 || out.displacement > math.MaxInt32 {
+				return memoryOffset{}, codeParsingError{
+					msg:          errors.New("The number that is added to a memory address must be representable in 32 bits"),
+					textLocation: number.location,
+				}
+			}
+		} else {
+			if out.index != "" {
+				return memoryOffset{}, codeParsingError{
+					msg:          errors.New("A memory address can only contain one variable other then the pointer, but `" + out.index + "` is already used"),
+					textLocation: index.location,
+				}
+			}
+			if isSubtracted {
+				return memoryOffset{}, codeParsingError{
+					msg:          errors.New("A variable cannot be subtracted from a memory address"),
+					textLocation: index.location,
+				}
+			}
+			if value != 1 && value != 2 && value != 4 && value != 8 {
+				return memoryOffset{}, codeParsingError{
+					msg:          errors.New("On x86-64, a variable in a memory address can only be multiplied by 1, 2, 4, or 8"),
+					textLocation: number.location,
+				}
+			}
+			out.index = index.contents
+			out.indexLocation = index.location
+			out.scale = uint8(value)
+		}
+
+		err := nextNonEmpty(keywords, "In a memory address, unexpected end of keywords")
+		if err.msg != nil {
+			return memoryOffset{}, err
+		}
+		expectOperator = true
+	}
+	panic("Unreachable")
+}
+
+// Returns true if `keywords.get()` is the start of a `len(...)` value
+func isLengthValue(keywords *listIterator[keyword]) bool {
+	return keywords.get().keywordType == Name && keywords.get().contents == "len" &&
+		keywords.currentIndex+1 < len(keywords.list) &&
+		keywords.list[keywords.currentIndex+1].contents == "("
+}
+
+// Parses a `len(...)` value. After a succsesful execution of this function, `keywords.get()`
+// returns the `)` at the end of the value.
+func parseLengthValue(keywords *listIterator[keyword]) (lengthValue, codeParsingError) {
+	out := lengthValue{textLocation: keywords.get().location}
+	assert(eq(keywords.next(), true))
+	err := nextNonEmpty(keywords, "After `len(`, unexpected end of keywords")
+	if err.msg != nil {
+		return lengthValue{}, err
+	}
+	if keywords.get().keywordType != StringValue && keywords.get().keywordType != Name {
+		return lengthValue{}, codeParsingError{
+			msg:          errors.New("Expected a keyword of type StringValue or Name in `len(...)`, got a keyword of type " + keywords.get().keywordType.String()),
+			textLocation: keywords.get().location,
+		}
+	}
+	out.value, err = parseRawValue(keywords)
+	if err.msg != nil {
+		return lengthValue{}, err
+	}
+	err = nextNonEmpty(keywords, "After the value in `len(...)`, unexpected end of keywords")
+	if err.msg != nil {
+		return lengthValue{}, err
+	}
+	if keywords.get().contents != ")" {
+		return lengthValue{}, codeParsingError{
+			msg:          errors.New("Expected `)` to end `len(...)`, got `" + keywords.get().contents + "`"),
+			textLocation: keywords.get().location,
+		}
+	}
+	return out, codeParsingError{}
+}
+
+// Returns true if `keywords.get()` is the start of a `sizeof(...)` value
+func isStructSizeValue(keywords *listIterator[keyword]) bool {
+	return keywords.get().keywordType == Name && keywords.get().contents == "sizeof" &&
+		keywords.currentIndex+1 < len(keywords.list) &&
+		keywords.list[keywords.currentIndex+1].contents == "("
+}
+
+// Parses a `sizeof(...)` value. After a succsesful execution of this function, `keywords.get()`
+// returns the `)` at the end of the value.
+func parseStructSizeValue(keywords *listIterator[keyword]) (structSizeValue, codeParsingError) {
+	out := structSizeValue{textLocation: keywords.get().location}
+	assert(eq(keywords.next(), true))
+	err := nextNonEmpty(keywords, "After `sizeof(`, unexpected end of keywords")
+	if err.msg != nil {
+		return structSizeValue{}, err
+	}
+	if keywords.get().keywordType != Name {
+		return structSizeValue{}, codeParsingError{
+			msg:          errors.New("Expected the name of a struct in `sizeof(...)`, got a keyword of type " + keywords.get().keywordType.String()),
+			textLocation: keywords.get().location,
+		}
+	}
+	out.structName = keywords.get().contents
+	err = nextNonEmpty(keywords, "After the struct in `sizeof(...)`, unexpected end of keywords")
+	if err.msg != nil {
+		return structSizeValue{}, err
+	}
+	if keywords.get().contents != ")" {
+		return structSizeValue{}, codeParsingError{
+			msg:          errors.New("Expected `)` to end `sizeof(...)`, got `" + keywords.get().contents + "`"),
+			textLocation: keywords.get().location,
+		}
+	}
+	return out, codeParsingError{}
+}
+
+// Converts an error from the `strconv` package into an error for the number in
+// `number.contents`
+func numberParsingError(number keyword, err error) codeParsingError {
+	if errors.Is(err, strconv.ErrRange) {
+		return codeParsingError{
+			msg:          errors.New("The number `" + number.contents + "` cannot be represented in 64 bits"),
+			textLocation: number.location,
+		}
+	}
+	return codeParsingError{
+		msg:          errors.New("`" + number.contents + "` is not a valid number. The digits of a number can be separated with `_`, and a number can start with `0x`, `0b`, or `0o` for hexadecimal, binary, or octal"),
+		textLocation: number.location,
+	}
+}
+
+// Removes the zeros at the start of an integer that does not start with `0x`, `0b`, or `0o`, so
+// that `strconv` reads it in decimal instead of octal, for example `-010` becomes `-10`
+func withoutLeadingZeros(integer string) string {
+	sign := ""
+	if strings.HasPrefix(integer, "-") {
+		sign, integer = "-", integer[1:]
+	}
+	if len(integer) > 1 && integer[0] == '0' && strings.ContainsRune("xXbBoO", rune(integer[1])) {
+		return sign + integer
+	}
+	integer = strings.TrimLeft(integer, "0_")
+	if integer == "" {
+		integer = "0"
+	}
+	return sign + integer
+}
+
 func parseRawValue(keywords *listIterator[keyword]) (rawValue, codeParsingError) {
+	if isLengthValue(keywords) {
+		return parseLengthValue(keywords)
+	}
+	if isStructSizeValue(keywords) {
+		return parseStructSizeValue(keywords)
+	}
 	switch keywords.get().keywordType {
-	case Name, DropVariable, Dereference:
+	case Name, DropVariable, Dereference, NameWithColon:
 		return parseVariableValue(keywords)
 	case PositiveInteger:
-		number, err := strconv.ParseUint(keywords.get().contents, 10, 64)
-		assert(eq(err, nil))
+		number, err := strconv.ParseUint(withoutLeadingZeros(keywords.get().contents), 0, 64)
+		if err != nil {
+			return nil, numberParsingError(*keywords.get(), err)
+		}
 		return numberValue[uint64]{
 			textLocation: keywords.get().location,
 			value:        number,
 		}, codeParsingError{}
 	case NegativeInteger:
-		number, err := strconv.ParseInt(keywords.get().contents, 10, 64)
-		assert(eq(err, nil))
+		number, err := strconv.ParseInt(withoutLeadingZeros(keywords.get().contents), 0, 64)
+		if err != nil {
+			return nil, numberParsingError(*keywords.get(), err)
+		}
 		return numberValue[int64]{
 			textLocation: keywords.get().location,
 			value:        number,
 		}, codeParsingError{}
 	case Decimal:
 		number, err := strconv.ParseFloat(keywords.get().contents, 64)
-		assert(eq(err, nil))
+		if err != nil {
+			return nil, numberParsingError(*keywords.get(), err)
+		}
 		return numberValue[float64]{
 			textLocation: keywords.get().location,
 			value:        number,
 		}, codeParsingError{}
 	case CharValue:
 		assert(eq(keywords.get().contents[0], '\''))
-		assert(eq(keywords.get().contents[len(keywords.get().contents)-1], '\''))
+		value, errs := decodeQuotedValue(keywords.get().contents, keywords.get().location)
+		assert(eq(len(errs), 0))
 		return characterValue{
 			textLocation: keywords.get().location,
-			value:        keywords.get().contents[1 : len(keywords.get().contents)-1],
+			value:        value,
 		}, codeParsingError{}
 	case StringValue:
 		assert(eq(keywords.get().contents[0], '"'))
-		assert(eq(keywords.get().contents[len(keywords.get().contents)-1], '"'))
+		value, errs := decodeQuotedValue(keywords.get().contents, keywords.get().location)
+		assert(eq(len(errs), 0))
 		return stringValue{
 			textLocation: keywords.get().location,
-			value:        keywords.get().contents[1 : len(keywords.get().contents)-1],
+			value:        value,
 		}, codeParsingError{}
 	default:
 		return nil, codeParsingError{
@@ -291,13 +674,15 @@ func parseComparison(keywordList []keyword) (condition, codeParsingError) {
 	unchainedComparisons := []condition{}
 	keywords := listIterator[keyword]{list: keywordList}
 
+	// In chained comparisons, the second value of each comparison is the first value of the next
+	// comparison
+	comparisonFirstArg, err := parseRawValue(&keywords)
+	if err.msg != nil {
+		return nil, err
+	}
 	for true {
-		comparisonFirstArg, err := parseRawValue(&keywords)
-		if err.msg != nil {
-			return nil, err
-		}
 		if !keywords.next() {
-			if keywords.currentIndex == 0 {
+			if len(unchainedComparisons) == 0 {
 				return nil, codeParsingError{
 					textLocation: keywords.get().location,
 					msg:          errors.New("Unexpected end of comparison, expecting either >, >=, <, <=, ==, or !="),
@@ -380,6 +765,7 @@ func parseComparison(keywordList []keyword) (condition, codeParsingError) {
 			leftValue:    comparisonFirstArg,
 			rightValue:   comparisonSecondArg,
 		}))
+		comparisonFirstArg = comparisonSecondArg
 	}
 	panic("Unreachable")
 }
@@ -403,6 +789,17 @@ func parseConditionClauses(
 	}, codeParsingError{}
 }
 
+// Parses the name of the loop after `break` or `continue`, for example `outer` in `break outer`. If
+// there is no name after the keyword, then this returns a blank string.
+func parseOptionalLoopLabel(keywords *listIterator[keyword]) string {
+	if keywords.currentIndex+1 < len(keywords.list) &&
+		keywords.list[keywords.currentIndex+1].keywordType == Name {
+		keywords.next()
+		return keywords.get().contents
+	}
+	return ""
+}
+
 // Parses a "conditional block" into an AbstractSyntaxTree node. This consists
 // of ignoring the first keyword, then parsing a condition, then parsing a
 // block. After a succsesful execution of this function, keywords.get().contents
@@ -432,6 +829,12 @@ func parseConditionalBlock(keywords *listIterator[keyword]) (textLocation, condi
 	}
 
 	// Parse the condition into AST
+	if len(conditionKeywords) == 0 {
+		return textLocation{}, nil, nil, codeParsingError{
+			msg:          errors.New("Expected a condition before `{`"),
+			textLocation: keywords.get().location,
+		}
+	}
 	condition, err := parseCondition(conditionKeywords)
 	if err.msg != nil {
 		return textLocation{}, nil, nil, err
@@ -462,6 +865,7 @@ func parseIfElseStatement(keywords *listIterator[keyword]) (ifElseStatement, cod
 		switch keywords.list[keywords.currentIndex+1].contents {
 		case "elif":
 			assert(eq(keywords.next(), true))
+			out.elseBlockLocation = keywords.get().location
 			elseBlockStatement, err := parseIfElseStatement(keywords)
 			if err.msg != nil {
 				return ifElseStatement{}, err
@@ -469,6 +873,7 @@ func parseIfElseStatement(keywords *listIterator[keyword]) (ifElseStatement, cod
 			out.elseBlock = []statement{elseBlockStatement}
 		case "else":
 			assert(eq(keywords.next(), true))
+			out.elseBlockLocation = keywords.get().location
 			if !keywords.next() {
 				return ifElseStatement{}, codeParsingError{
 					msg:          errors.New("Unexpected end of keywords. Either remove the else, or add a block after the else."),
@@ -567,18 +972,46 @@ func parseBlock(keywords *listIterator[keyword]) ([]statement, codeParsingError)
 				return nil, err
 			}
 			add(&ASTitems, statement(conditionalBlock))
-		case WhileLoop:
+		case WhileLoop, NameWithColon:
 			loop := whileLoop{}
+			if keywords.get().keywordType == NameWithColon {
+				loop.label = keywords.get().contents[:len(keywords.get().contents)-1]
+				if !keywords.next() || keywords.get().keywordType != WhileLoop {
+					return nil, codeParsingError{
+						msg:          errors.New("Expected a while loop after `" + loop.label + ":`, since a name followed by `:` at the start of a statement names the loop after it"),
+						textLocation: keywords.get().location,
+					}
+				}
+			}
 			err := codeParsingError{}
 			loop.textLocation, loop.condition, loop.loopBody, err = parseConditionalBlock(keywords)
 			if err.msg != nil {
 				return nil, err
 			}
 			add(&ASTitems, statement(loop))
+		case Defer:
+			location := keywords.get().location
+			err := nextNonEmpty(keywords, "After `defer`, unexpected end of keywords")
+			if err.msg != nil {
+				return nil, err
+			}
+			deferredBlock, err := parseBlock(keywords)
+			if err.msg != nil {
+				return nil, err
+			}
+			if returnLocation, containsReturn := findReturnStatement(deferredBlock); containsReturn {
+				return nil, codeParsingError{
+					msg:          errors.New("Deferred code cannot return from the function"),
+					textLocation: returnLocation,
+				}
+			}
+			add(&ASTitems, statement(deferStatement{textLocation: location, block: deferredBlock}))
 		case BreakStatement:
-			add(&ASTitems, statement(breakStatement(keywords.get().location)))
+			location := keywords.get().location
+			add(&ASTitems, statement(breakStatement{textLocation: location, label: parseOptionalLoopLabel(keywords)}))
 		case ContinueStatement:
-			add(&ASTitems, statement(continueStatement(keywords.get().location)))
+			location := keywords.get().location
+			add(&ASTitems, statement(continueStatement{textLocation: location, label: parseOptionalLoopLabel(keywords)}))
 
 		// The only valid statement that starts with decrease nesting is }, which exits the block scope
 		case DecreaseNesting:
@@ -601,6 +1034,30 @@ func parseBlock(keywords *listIterator[keyword]) ([]statement, codeParsingError)
 	panic("Unreachable")
 }
 
+// Returns the location of a return statement in `block` or any block inside of it, and whether
+// there is one
+func findReturnStatement(block []statement) (textLocation, bool) {
+	for _, untypedStatement := range block {
+		innerBlocks := [][]statement{}
+		switch item := untypedStatement.(type) {
+		case returnStatement:
+			return item.textLocation, true
+		case ifElseStatement:
+			innerBlocks = [][]statement{item.ifBlock, item.elseBlock}
+		case whileLoop:
+			innerBlocks = [][]statement{item.loopBody}
+		case deferStatement:
+			innerBlocks = [][]statement{item.block}
+		}
+		for _, innerBlock := range innerBlocks {
+			if location, containsReturn := findReturnStatement(innerBlock); containsReturn {
+				return location, true
+			}
+		}
+	}
+	return textLocation{}, false
+}
+
 // After a succsesful execution of this function, `keywords.get()` should return
 // the keyword after the end of the mutation destination.
 func parseVariableMutationDestination(keywords *listIterator[keyword]) ([]variableMutationDestination, codeParsingError) {
@@ -616,7 +1073,8 @@ func parseVariableMutationDestination(keywords *listIterator[keyword]) ([]variab
 			}
 		}
 
-		if keywords.get().keywordType == Dereference || keywords.get().keywordType == Name {
+		if keywords.get().keywordType == Dereference || keywords.get().keywordType == Name ||
+			keywords.get().keywordType == NameWithColon {
 			variable, err := parseVariableValue(keywords)
 			if err.msg != nil {
 				return nil, err
@@ -629,6 +1087,10 @@ func parseVariableMutationDestination(keywords *listIterator[keyword]) ([]variab
 			}
 			current.name = variable.name
 			current.pointerDereferenceLayers = variable.pointerDereferenceLayers
+			current.dereferenceSize = variable.dereferenceSize
+			current.offset = variable.offset
+			current.field = variable.field
+			current.typeName = variable.typeName
 			err = nextNonEmpty(keywords, "While parsing the destination for a variable mutation, after name, unexpected end of keywords")
 			if err.msg != nil {
 				return nil, err
@@ -655,6 +1117,96 @@ func parseVariableMutationDestination(keywords *listIterator[keyword]) ([]variab
 	panic("Unreachable")
 }
 
+// Returns true if `keywords.get()` is the start of a function call, like `myFunction(r0=1)`
+func isFunctionCall(keywords *listIterator[keyword]) bool {
+	return keywords.get().keywordType == Name && !isLengthValue(keywords) && !isStructSizeValue(keywords) &&
+		keywords.currentIndex+1 < len(keywords.list) &&
+		keywords.list[keywords.currentIndex+1].contents == "("
+}
+
+// The precedence of each operator in an arithmetic expression. Operators with a higher precedence
+// are calculated first.
+var arithmeticOperatorPrecedence = map[string]int{
+	"|":   1,
+	"xor": 2,
+	"&":   3,
+	"<<":  4, ">>": 4, ">>>": 4,
+	"+": 5, "-": 5,
+	"*": 6, "/": 6, "%": 6,
+}
+
+// Parses a value that can contain arithmetic, for example `width * (height + 4)`. Operators with the
+// same precedence are calculated from left to right. After a succsesful execution of this function,
+// `keywords.get()` returns the last keyword of the value.
+func parseExpression(keywords *listIterator[keyword]) (rawValue, codeParsingError) {
+	return parseExpressionWithMinimumPrecedence(keywords, 1)
+}
+
+// Parses an expression that stops before the first operator with a precedence lower than
+// `minimumPrecedence`
+func parseExpressionWithMinimumPrecedence(
+	keywords *listIterator[keyword],
+	minimumPrecedence int,
+) (rawValue, codeParsingError) {
+	left, err := parseExpressionOperand(keywords)
+	if err.msg != nil {
+		return nil, err
+	}
+	for true {
+		// Return if the next keyword is not an operator that should be parsed here
+		indexBeforeOperator := keywords.currentIndex
+		if !keywords.next() || keywords.get().keywordType != BinaryOperator ||
+			arithmeticOperatorPrecedence[keywords.get().contents] < minimumPrecedence {
+			keywords.currentIndex = indexBeforeOperator
+			return left, codeParsingError{}
+		}
+
+		// Parse the operator and the value on the right of it
+		operator := *keywords.get()
+		err = nextNonEmpty(keywords, "After `"+operator.contents+"`, unexpected end of keywords")
+		if err.msg != nil {
+			return nil, err
+		}
+		right, err := parseExpressionWithMinimumPrecedence(
+			keywords, arithmeticOperatorPrecedence[operator.contents]+1)
+		if err.msg != nil {
+			return nil, err
+		}
+		left = arithmeticExpression{
+			textLocation: operator.location,
+			operator:     operator.contents,
+			left:         left,
+			right:        right,
+		}
+	}
+	panic("Unreachable")
+}
+
+// Parses either a raw value, or an expression in brackets
+func parseExpressionOperand(keywords *listIterator[keyword]) (rawValue, codeParsingError) {
+	if keywords.get().contents != "(" {
+		return parseRawValue(keywords)
+	}
+	openingBracket := *keywords.get()
+	err := nextNonEmpty(keywords, "After `(`, unexpected end of keywords")
+	if err.msg != nil {
+		return nil, err
+	}
+	value, err := parseExpression(keywords)
+	if err.msg != nil {
+		return nil, err
+	}
+	if !keywords.next() || keywords.get().contents != ")" {
+		return nil, codeParsingError{
+			msg: errors.New("Expected `)` to close the `(` at line " + fmt.Sprint(openingBracket.location.line) +
+				" and column " + fmt.Sprint(openingBracket.location.column) + ", got `" +
+				keywords.get().contents + "`"),
+			textLocation: keywords.get().location,
+		}
+	}
+	return value, codeParsingError{}
+}
+
 // Parses a statement starting with a keyword of type Name, Register, DropVariable, or Dereference
 // into an AST item. Examples of this type of statement include:
 // - `b0 returnStatus, b1 = myFunction(b1="test", b2=myVariable)`
@@ -671,8 +1223,10 @@ func parseMutationStatement(keywords *listIterator[keyword]) (mutationStatement,
 		return mutationStatement{}, err
 	}
 
-	// Parse =, ++, --, +=, -=, *=, /=, and (if needed) `valueBeingAssignedToVariable`
+	// Parse =, ++, --, +=, -=, *=, /=, &=, |=, xor=, <<=, >>=, >>>=, and (if needed)
+	// `valueBeingAssignedToVariable`
 	mutationOperation := keywords.get().keywordType
+	isArithmeticShift := keywords.get().contents == ">>="
 	switch mutationOperation {
 
 	default:
@@ -680,7 +1234,8 @@ func parseMutationStatement(keywords *listIterator[keyword]) (mutationStatement,
 			textLocation: keywords.get().location,
 			msg: errors.New("After a variable/register that is being mutated, expected" +
 				" a keyword of type Assignment, Increment, Decrement, PlusEquals, " +
-				"MinusEquals, MultiplyEquals, or DivideEquals, got `" +
+				"MinusEquals, MultiplyEquals, DivideEquals, AndEquals, OrEquals, " +
+				"XorEquals, ShiftLeftEquals, or ShiftRightEquals, got `" +
 				keywords.get().contents + "` of type " +
 				keywords.get().keywordType.String()),
 		}
@@ -691,7 +1246,8 @@ func parseMutationStatement(keywords *listIterator[keyword]) (mutationStatement,
 	case Decrement:
 		out.operation = decrementBy1{keywords.get().location}
 
-	case Assignment, PlusEquals, MinusEquals, MultiplyEquals, DivideEquals:
+	case Assignment, PlusEquals, MinusEquals, MultiplyEquals, DivideEquals, AndEquals, OrEquals,
+		XorEquals, ShiftLeftEquals, ShiftRightEquals:
 		// Next keyword
 		err = nextNonEmpty(keywords, "After `"+keywords.get().contents+
 			"` (variable mutation operator), unexpected end of keywords")
@@ -699,23 +1255,37 @@ func parseMutationStatement(keywords *listIterator[keyword]) (mutationStatement,
 			return mutationStatement{}, err
 		}
 
-		// Custom parsing of assignment where first keyword of value is of type Name, since that could be a function call
-		if mutationOperation == Assignment && keywords.get().keywordType == Name {
+		// Parse `not` before the value of an assignment
+		isNot := false
+		if mutationOperation == Assignment && keywords.get().keywordType == Not {
+			isNot = true
+			err = nextNonEmpty(keywords, "After `not`, unexpected end of keywords")
+			if err.msg != nil {
+				return mutationStatement{}, err
+			}
+		}
+
+		// Parse `ignore` before a function call
+		resultIsIgnored := false
+		if mutationOperation == Assignment && !isNot && keywords.get().keywordType == Ignore {
+			resultIsIgnored = true
+			err = nextNonEmpty(keywords, "After `ignore`, unexpected end of keywords")
+			if err.msg != nil {
+				return mutationStatement{}, err
+			}
+			if !isFunctionCall(keywords) {
+				return mutationStatement{}, codeParsingError{
+					textLocation: keywords.get().location,
+					msg:          errors.New("Expected a function call after `ignore`"),
+				}
+			}
+		}
+
+		// Custom parsing of assignment where the value is a function call
+		if mutationOperation == Assignment && !isNot && isFunctionCall(keywords) {
 			// Parse name
 			name := keywords.get()
-			oldKeywordsIndex := keywords.currentIndex
-
-			// Early return if this is a variable reference, and not a function call
-			if !keywords.next() || keywords.get().keywordType != IncreaseNesting || keywords.get().contents != "(" {
-				keywords.currentIndex = oldKeywordsIndex
-				out.operation = setToRawValue{val: variableValue{
-					name:                     name.contents,
-					textLocation:             name.location,
-					variableIsDropped:        false,
-					pointerDereferenceLayers: 0,
-				}}
-				return out, codeParsingError{}
-			}
+			assert(eq(keywords.next(), true))
 
 			// Parse (
 			err := nextNonEmpty(keywords, "After Name and then (, unexpected end of keywords")
@@ -736,18 +1306,28 @@ func parseMutationStatement(keywords *listIterator[keyword]) (mutationStatement,
 
 			// Set the mutation operation
 			out.operation = setToFunctionCallValue{
-				textLocation: name.location,
-				functionName: name.contents,
-				functionArgs: functionArguments,
+				textLocation:    name.location,
+				functionName:    name.contents,
+				functionArgs:    functionArguments,
+				resultIsIgnored: resultIsIgnored,
 			}
 		} else {
-			rawValue, err := parseRawValue(keywords)
+			var rawValue rawValue
+			if isNot {
+				rawValue, err = parseRawValue(keywords)
+			} else {
+				rawValue, err = parseExpression(keywords)
+			}
 			if err.msg != nil {
 				return mutationStatement{}, err
 			}
 			switch mutationOperation {
 			case Assignment:
-				out.operation = setToRawValue{val: rawValue}
+				if isNot {
+					out.operation = setToNotOfRawValue{val: rawValue}
+				} else {
+					out.operation = setToRawValue{val: rawValue}
+				}
 			case PlusEquals:
 				out.operation = incrementByRawValue{val: rawValue}
 			case MinusEquals:
@@ -756,6 +1336,16 @@ func parseMutationStatement(keywords *listIterator[keyword]) (mutationStatement,
 				out.operation = multiplyByRawValue{val: rawValue}
 			case DivideEquals:
 				out.operation = divideByRawValue{val: rawValue}
+			case AndEquals:
+				out.operation = andByRawValue{val: rawValue}
+			case OrEquals:
+				out.operation = orByRawValue{val: rawValue}
+			case XorEquals:
+				out.operation = xorByRawValue{val: rawValue}
+			case ShiftLeftEquals:
+				out.operation = shiftLeftByRawValue{val: rawValue}
+			case ShiftRightEquals:
+				out.operation = shiftRightByRawValue{val: rawValue, isArithmetic: isArithmeticShift}
 			}
 		}
 
@@ -792,6 +1382,12 @@ func parseFunctionDefinition(keywords *listIterator[keyword]) (functionDefinitio
 				fmt.Sprint(reflect.TypeOf(mutationStatement.operation))),
 		}
 	}
+	if functionCall.resultIsIgnored {
+		return functionDefinition{}, codeParsingError{
+			textLocation: mutationStatement.textLocation,
+			msg:          errors.New("`ignore` cannot be used in a function head"),
+		}
+	}
 	out.mutatedRegisters = make([]registerAndNameAndLocation, len(mutationStatement.destination))
 	for i, mutatedItem := range mutationStatement.destination {
 		if mutatedItem.pointerDereferenceLayers > 0 {
@@ -809,6 +1405,7 @@ func parseFunctionDefinition(keywords *listIterator[keyword]) (functionDefinitio
 		out.mutatedRegisters[i] = registerAndNameAndLocation{
 			register:     mutatedItem.register,
 			name:         mutatedItem.name,
+			typeName:     mutatedItem.typeName,
 			textLocation: mutatedItem.textLocation,
 		}
 	}
@@ -842,6 +1439,7 @@ func parseFunctionDefinition(keywords *listIterator[keyword]) (functionDefinitio
 		}
 		out.arguments[i].register = argument.register
 		out.arguments[i].name = variableValue.name
+		out.arguments[i].typeName = variableValue.typeName
 		out.arguments[i].textLocation = argument.textLocation
 	}
 	err = nextNonEmpty(keywords, "After function head, unexpected end of keywords")
@@ -859,6 +1457,278 @@ func parseFunctionDefinition(keywords *listIterator[keyword]) (functionDefinitio
 	return out, codeParsingError{}
 }
 
+// Parses a constant definition like `const PAGE_SIZE = 4096`. After a succsesful execution of this
+// function, `keywords.get()` returns the last keyword of the constant's value.
+func parseConstantDefinition(keywords *listIterator[keyword]) (constantDefinition, codeParsingError) {
+	assert(eq(keywords.get().keywordType, Constant))
+	out := constantDefinition{textLocation: keywords.get().location}
+	err := nextNonEmpty(keywords, "After `const`, unexpected end of keywords")
+	if err.msg != nil {
+		return constantDefinition{}, err
+	}
+	if keywords.get().keywordType != Name {
+		return constantDefinition{}, codeParsingError{
+			msg:          errors.New("Expected the name of the constant after `const`, got `" + keywords.get().contents + "`"),
+			textLocation: keywords.get().location,
+		}
+	}
+	out.name = keywords.get().contents
+	err = nextNonEmpty(keywords, "After the name of a constant, unexpected end of keywords")
+	if err.msg != nil {
+		return constantDefinition{}, err
+	}
+	if keywords.get().keywordType != Assignment || keywords.get().contents != "=" {
+		return constantDefinition{}, codeParsingError{
+			msg:          errors.New("Expected `=` after the name of a constant, got `" + keywords.get().contents + "`"),
+			textLocation: keywords.get().location,
+		}
+	}
+	err = nextNonEmpty(keywords, "After `=`, unexpected end of keywords")
+	if err.msg != nil {
+		return constantDefinition{}, err
+	}
+	out.value, err = parseExpression(keywords)
+	if err.msg != nil {
+		return constantDefinition{}, err
+	}
+	return out, codeParsingError{}
+}
+
+// Parses a global variable definition like `var counter: u64 = 0`. After a succsesful execution of
+// this function, `keywords.get()` returns the last keyword of the definition.
+func parseGlobalVariableDefinition(keywords *listIterator[keyword]) (globalVariableDefinition, codeParsingError) {
+	assert(eq(keywords.get().keywordType, GlobalVariable))
+	out := globalVariableDefinition{textLocation: keywords.get().location}
+	err := nextNonEmpty(keywords, "After `var`, unexpected end of keywords")
+	if err.msg != nil {
+		return globalVariableDefinition{}, err
+	}
+
+	// `counter:` is lexed as one NameWithColon keyword
+	if keywords.get().keywordType != NameWithColon {
+		return globalVariableDefinition{}, codeParsingError{
+			msg: errors.New("Expected the name of the global variable followed by `:` and its size, " +
+				"for example `var counter: u64`, got `" + keywords.get().contents + "`"),
+			textLocation: keywords.get().location,
+		}
+	}
+	out.name = keywords.get().contents[:len(keywords.get().contents)-1]
+	err = nextNonEmpty(keywords, "After the name of a global variable, unexpected end of keywords")
+	if err.msg != nil {
+		return globalVariableDefinition{}, err
+	}
+	size, isSize := memoryAccessSizes[keywords.get().contents]
+	if keywords.get().keywordType != Name || !isSize {
+		return globalVariableDefinition{}, codeParsingError{
+			msg: errors.New("Expected the size of a global variable to be u8, i8, u16, i16, u32, " +
+				"i32, u64, or i64, got `" + keywords.get().contents + "`"),
+			textLocation: keywords.get().location,
+		}
+	}
+	out.size = size
+
+	// Parse the value that the variable starts as if there is one
+	if keywords.currentIndex+1 >= len(keywords.list) ||
+		keywords.list[keywords.currentIndex+1].keywordType != Assignment {
+		return out, codeParsingError{}
+	}
+	assert(eq(keywords.next(), true))
+	if keywords.get().contents != "=" {
+		return globalVariableDefinition{}, codeParsingError{
+			msg:          errors.New("Expected `=` after the size of a global variable, got `" + keywords.get().contents + "`"),
+			textLocation: keywords.get().location,
+		}
+	}
+	err = nextNonEmpty(keywords, "After `=`, unexpected end of keywords")
+	if err.msg != nil {
+		return globalVariableDefinition{}, err
+	}
+	out.value, err = parseExpression(keywords)
+	if err.msg != nil {
+		return globalVariableDefinition{}, err
+	}
+	return out, codeParsingError{}
+}
+
+// Parses a buffer definition like `buffer inputBuffer[4096]`. `buffer` is not a keyword, so that it
+// can still be used as the name of a variable. After a succsesful execution of this function,
+// `keywords.get()` returns the `]` at the end of the definition.
+func parseBufferDefinition(keywords *listIterator[keyword]) (bufferDefinition, codeParsingError) {
+	assert(eq(keywords.get().contents, "buffer"))
+	out := bufferDefinition{textLocation: keywords.get().location}
+	err := nextNonEmpty(keywords, "After `buffer`, unexpected end of keywords")
+	if err.msg != nil {
+		return bufferDefinition{}, err
+	}
+	if keywords.get().keywordType != Name {
+		return bufferDefinition{}, codeParsingError{
+			msg:          errors.New("Expected the name of the buffer after `buffer`, got `" + keywords.get().contents + "`"),
+			textLocation: keywords.get().location,
+		}
+	}
+	out.name = keywords.get().contents
+	err = nextNonEmpty(keywords, "After the name of a buffer, unexpected end of keywords")
+	if err.msg != nil {
+		return bufferDefinition{}, err
+	}
+	if keywords.get().contents != "[" {
+		return bufferDefinition{}, codeParsingError{
+			msg: errors.New("Expected `[` followed by the number of bytes in the buffer, for " +
+				"example `buffer " + out.name + "[4096]`, got `" + keywords.get().contents + "`"),
+			textLocation: keywords.get().location,
+		}
+	}
+	err = nextNonEmpty(keywords, "After `[`, unexpected end of keywords")
+	if err.msg != nil {
+		return bufferDefinition{}, err
+	}
+	out.length, err = parseExpression(keywords)
+	if err.msg != nil {
+		return bufferDefinition{}, err
+	}
+	if !keywords.next() || keywords.get().contents != "]" {
+		return bufferDefinition{}, codeParsingError{
+			msg:          errors.New("Expected `]` after the number of bytes in the buffer, got `" + keywords.get().contents + "`"),
+			textLocation: keywords.get().location,
+		}
+	}
+	return out, codeParsingError{}
+}
+
+// Parses a struct definition like `struct Point { x: i64, y: i64 }`, where the fields can be
+// separated by commas or newlines. After a succsesful execution of this function,
+// `keywords.get().contents` should equal to "}".
+func parseStructDefinition(keywords *listIterator[keyword]) (structDefinition, codeParsingError) {
+	assert(eq(keywords.get().keywordType, Struct))
+	out := structDefinition{textLocation: keywords.get().location}
+	err := nextNonEmpty(keywords, "After `struct`, unexpected end of keywords")
+	if err.msg != nil {
+		return structDefinition{}, err
+	}
+	if keywords.get().keywordType != Name {
+		return structDefinition{}, codeParsingError{
+			msg:          errors.New("Expected the name of the struct after `struct`, got `" + keywords.get().contents + "`"),
+			textLocation: keywords.get().location,
+		}
+	}
+	out.name = keywords.get().contents
+	err = nextNonEmpty(keywords, "After the name of a struct, unexpected end of keywords")
+	if err.msg != nil {
+		return structDefinition{}, err
+	}
+	if keywords.get().contents != "{" {
+		return structDefinition{}, codeParsingError{
+			msg:          errors.New("Expected `{` after the name of a struct, got `" + keywords.get().contents + "`"),
+			textLocation: keywords.get().location,
+		}
+	}
+	for true {
+		err = nextNonEmpty(keywords, "While parsing the fields of a struct, unexpected end of keywords")
+		if err.msg != nil {
+			return structDefinition{}, err
+		}
+		switch keywords.get().keywordType {
+		case Newline, Comment, ListSyntax:
+			continue
+		case DecreaseNesting:
+			if len(out.fields) == 0 {
+				return structDefinition{}, codeParsingError{
+					msg:          errors.New("A struct must have at least one field"),
+					textLocation: keywords.get().location,
+				}
+			}
+			return out, codeParsingError{}
+		case NameWithColon:
+			field := structFieldDefinition{
+				textLocation: keywords.get().location,
+				name:         keywords.get().contents[:len(keywords.get().contents)-1],
+			}
+			err = nextNonEmpty(keywords, "After the name of a field, unexpected end of keywords")
+			if err.msg != nil {
+				return structDefinition{}, err
+			}
+			size, isSize := memoryAccessSizes[keywords.get().contents]
+			if keywords.get().keywordType != Name || !isSize {
+				return structDefinition{}, codeParsingError{
+					msg: errors.New("Expected the size of a field to be u8, i8, u16, i16, u32, i32, " +
+						"u64, or i64, got `" + keywords.get().contents + "`"),
+					textLocation: keywords.get().location,
+				}
+			}
+			field.size = size
+			add(&out.fields, field)
+		default:
+			return structDefinition{}, codeParsingError{
+				msg: errors.New("Expected the name of a field followed by `:` and its size, for " +
+					"example `x: i64`, got `" + keywords.get().contents + "`"),
+				textLocation: keywords.get().location,
+			}
+		}
+	}
+	panic("Unreachable")
+}
+
+func parseEnumDefinition(keywords *listIterator[keyword]) (enumDefinition, codeParsingError) {
+	assert(eq(keywords.get().keywordType, Enum))
+	out := enumDefinition{textLocation: keywords.get().location}
+	err := nextNonEmpty(keywords, "After `enum`, unexpected end of keywords")
+	if err.msg != nil {
+		return enumDefinition{}, err
+	}
+	if keywords.get().keywordType != Name {
+		return enumDefinition{}, codeParsingError{
+			msg:          errors.New("Expected the name of the enum after `enum`, got `" + keywords.get().contents + "`"),
+			textLocation: keywords.get().location,
+		}
+	}
+	out.name = keywords.get().contents
+	err = nextNonEmpty(keywords, "After the name of an enum, unexpected end of keywords")
+	if err.msg != nil {
+		return enumDefinition{}, err
+	}
+	if keywords.get().contents != "{" {
+		return enumDefinition{}, codeParsingError{
+			msg:          errors.New("Expected `{` after the name of an enum, got `" + keywords.get().contents + "`"),
+			textLocation: keywords.get().location,
+		}
+	}
+	for true {
+		err = nextNonEmpty(keywords, "While parsing the variants of an enum, unexpected end of keywords")
+		if err.msg != nil {
+			return enumDefinition{}, err
+		}
+		switch keywords.get().keywordType {
+		case Newline, Comment, ListSyntax:
+			continue
+		case DecreaseNesting:
+			if len(out.variants) == 0 {
+				return enumDefinition{}, codeParsingError{
+					msg:          errors.New("An enum must have at least one variant"),
+					textLocation: keywords.get().location,
+				}
+			}
+			return out, codeParsingError{}
+		case Name:
+			if strings.Contains(keywords.get().contents, ".") {
+				return enumDefinition{}, codeParsingError{
+					msg:          errors.New("The name of a variant cannot contain `.`"),
+					textLocation: keywords.get().location,
+				}
+			}
+			add(&out.variants, enumVariantDefinition{
+				textLocation: keywords.get().location,
+				name:         keywords.get().contents,
+			})
+		default:
+			return enumDefinition{}, codeParsingError{
+				msg:          errors.New("Expected the name of a variant, got `" + keywords.get().contents + "`"),
+				textLocation: keywords.get().location,
+			}
+		}
+	}
+	panic("Unreachable")
+}
+
 func parseTopLevelASTitems(bareKeywordList []keyword) ([]topLevelASTitem, codeParsingError) {
 	var ASTitems []topLevelASTitem
 	keywords := listIterator[keyword]{
@@ -869,23 +1739,69 @@ func parseTopLevelASTitems(bareKeywordList []keyword) ([]topLevelASTitem, codePa
 		switch keywords.get().keywordType {
 		case Newline, Comment:
 		case Import:
-			// TODO: Design and implement the ability to import other common assembly files:
+			// TODO: Design and implement the ability to import other common assembly files, rather then
+			// just the modules of the standard library:
 			// - Should we force their to only be one import per file that lists every dependency?
 			// - Do we even need imports? We could just automatically import things based on the characters before the period (EG: `std.math.intToString 42`)
 			//   - How do we handle overlap, for example if there was a function called std that was defined in a file in the folder?
-			return nil, codeParsingError{
-				msg:          errors.New("Import statements are not supported yet"),
-				textLocation: keywords.get().location,
+			importAST := importStatement{textLocation: keywords.get().location}
+			err := nextNonEmpty(&keywords, "After `import`, unexpected end of keywords")
+			if err.msg != nil {
+				return nil, err
 			}
+			if keywords.get().keywordType != Name {
+				return nil, codeParsingError{
+					msg:          errors.New("Expected the name of a module in the standard library after `import`, got `" + keywords.get().contents + "`"),
+					textLocation: keywords.get().location,
+				}
+			}
+			importAST.module = keywords.get().contents
+			add(&ASTitems, topLevelASTitem(importAST))
 		case Function:
 			functionAST, err := parseFunctionDefinition(&keywords)
 			if err.msg != nil {
 				return nil, err
 			}
 			add(&ASTitems, topLevelASTitem(functionAST))
+		case Constant:
+			constant, err := parseConstantDefinition(&keywords)
+			if err.msg != nil {
+				return nil, err
+			}
+			add(&ASTitems, topLevelASTitem(constant))
+		case GlobalVariable:
+			variable, err := parseGlobalVariableDefinition(&keywords)
+			if err.msg != nil {
+				return nil, err
+			}
+			add(&ASTitems, topLevelASTitem(variable))
+		case Struct:
+			structAST, err := parseStructDefinition(&keywords)
+			if err.msg != nil {
+				return nil, err
+			}
+			add(&ASTitems, topLevelASTitem(structAST))
+		case Enum:
+			enum, err := parseEnumDefinition(&keywords)
+			if err.msg != nil {
+				return nil, err
+			}
+			add(&ASTitems, topLevelASTitem(enum))
+		case Name:
+			if keywords.get().contents != "buffer" {
+				return nil, codeParsingError{
+					msg:          errors.New("Expected a function, constant, global variable, buffer, struct, or enum definition, got `" + keywords.get().contents + "`"),
+					textLocation: keywords.get().location,
+				}
+			}
+			buffer, err := parseBufferDefinition(&keywords)
+			if err.msg != nil {
+				return nil, err
+			}
+			add(&ASTitems, topLevelASTitem(buffer))
 		default:
 			return nil, codeParsingError{
-				msg:          errors.New("Expecting keyword of type `Newline`, `Comment` `Import`, or `Function`. Got a keyword of type `" + keywords.get().keywordType.String() + "`."),
+				msg:          errors.New("Expecting keyword of type `Newline`, `Comment` `Import`, `Function`, `Constant`, `GlobalVariable`, `Struct`, `Enum`, or `Name`. Got a keyword of type `" + keywords.get().keywordType.String() + "`."),
 				textLocation: keywords.get().location,
 			}
 		}
@@ -0,0 +1,176 @@
+package main
+
+// std.go
+// ======
+// Responsible for the standard library, which is a list of modules that are written in common
+// assembly, and shipped inside the compiler.
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+//go:embed std/*.ca
+var standardLibrary embed.FS
+
+// A module of the standard library that is imported by the file that is being compiled, or by
+// another module
+type importedModule struct {
+	importAST importStatement
+	keywords  []keyword
+	AST       []topLevelASTitem
+}
+
+// Replaces every import statement in `AST` with the definitions in the module of the standard
+// library that it imports. Each module is only added once, even if it is imported several times,
+// and the modules that a module imports are also added. Also returns the import statement that
+// added each module, so that errors in the code of a module can be given at the import statement.
+//
+// A module can define a name that is also defined in the file that is being compiled or in another
+// module. Each of these names is renamed inside the module to a name that cannot be written in
+// common assembly, so the module keeps using its own definition, and the name only refers to the
+// definition in the file or module that uses it.
+func addImportedModules(AST []topLevelASTitem) ([]topLevelASTitem, map[string]importStatement, codeParsingError) {
+	out := []topLevelASTitem{}
+	importedModules := make(map[string]importStatement)
+	modules := []importedModule{}
+	imports := []importStatement{}
+	for _, item := range AST {
+		if importAST, isImport := item.(importStatement); isImport {
+			add(&imports, importAST)
+		} else {
+			add(&out, item)
+		}
+	}
+	for index := 0; index < len(imports); index++ {
+		importAST := imports[index]
+		if _, alreadyImported := importedModules[importAST.module]; alreadyImported {
+			continue
+		}
+		importedModules[importAST.module] = importAST
+		module, err := parseStandardLibraryModule(importAST)
+		if err.msg != nil {
+			return nil, nil, err
+		}
+		for _, item := range module.AST {
+			if moduleImport, isImport := item.(importStatement); isImport {
+				add(&imports, moduleImport)
+			}
+		}
+		add(&modules, module)
+	}
+
+	// Count how many of the file and the modules define each name
+	numberOfDefinitions := make(map[string]int)
+	for name := range topLevelNames(out) {
+		numberOfDefinitions[name]++
+	}
+	for _, module := range modules {
+		for name := range topLevelNames(module.AST) {
+			numberOfDefinitions[name]++
+		}
+	}
+
+	for _, module := range modules {
+		renamed := false
+		for name := range topLevelNames(module.AST) {
+			if numberOfDefinitions[name] > 1 {
+				renameInModule(module, name)
+				renamed = true
+			}
+		}
+		if renamed {
+			var err codeParsingError
+			module.AST, err = parseTopLevelASTitems(module.keywords)
+			if err.msg != nil {
+				return nil, nil, errorInModule(module.importAST, err)
+			}
+		}
+		for _, item := range module.AST {
+			if _, isImport := item.(importStatement); !isImport {
+				add(&out, item)
+			}
+		}
+	}
+	return out, importedModules, codeParsingError{}
+}
+
+// Returns the names of the functions, constants, global variables, buffers, structs, and enums that
+// are defined in `AST`
+func topLevelNames(AST []topLevelASTitem) map[string]bool {
+	names := make(map[string]bool)
+	for _, item := range AST {
+		switch definition := item.(type) {
+		case functionDefinition:
+			names[definition.name] = true
+		case constantDefinition:
+			names[definition.name] = true
+		case globalVariableDefinition:
+			names[definition.name] = true
+		case bufferDefinition:
+			names[definition.name] = true
+		case structDefinition:
+			names[definition.name] = true
+		case enumDefinition:
+			names[definition.name] = true
+		}
+	}
+	return names
+}
+
+// Renames every use of `name` in the keywords of `module`, including the part of a name before a
+// `.`, like the name of the enum in `Color.red`. The new name contains a `:`, which cannot be part
+// of a name that is written in common assembly.
+func renameInModule(module importedModule, name string) {
+	for index, keyword := range module.keywords {
+		if keyword.keywordType != Name {
+			continue
+		}
+		before, after, hasField := strings.Cut(keyword.contents, ".")
+		if before != name {
+			continue
+		}
+		module.keywords[index].contents = module.importAST.module + ":" + name
+		if hasField {
+			module.keywords[index].contents += "." + after
+		}
+	}
+}
+
+// Lexes and parses the module of the standard library that `importAST` imports. Since the code of
+// the module is not in the file that is being compiled, any errors in the module are given at the
+// location of the import statement.
+func parseStandardLibraryModule(importAST importStatement) (importedModule, codeParsingError) {
+	code, err := standardLibrary.ReadFile("std/" + importAST.module + ".ca")
+	if err != nil {
+		return importedModule{}, codeParsingError{
+			msg:          errors.New("Could not find a module called `" + importAST.module + "` in the standard library"),
+			textLocation: importAST.textLocation,
+		}
+	}
+	keywords, errs := lexCode(string(code))
+	if len(errs) > 0 {
+		return importedModule{}, errorInModule(importAST, errs[0])
+	}
+	for index := range keywords {
+		keywords[index].location.module = importAST.module
+	}
+	AST, parsingErr := parseTopLevelASTitems(keywords)
+	if parsingErr.msg != nil {
+		return importedModule{}, errorInModule(importAST, parsingErr)
+	}
+	return importedModule{importAST: importAST, keywords: keywords, AST: AST}, codeParsingError{}
+}
+
+// Moves `err`, which is in the code of the module that `importAST` imports, to the location of
+// `importAST`.
+func errorInModule(importAST importStatement, err codeParsingError) codeParsingError {
+	return codeParsingError{
+		isWarning: err.isWarning,
+		msg: errors.New("At line " + fmt.Sprint(err.line) + " and column " + fmt.Sprint(err.column) +
+			" of the `" + importAST.module + "` module: " + err.msg.Error()),
+		textLocation: importAST.textLocation,
+	}
+}